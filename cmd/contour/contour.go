@@ -16,11 +16,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	clientset "github.com/heptio/contour/apis/generated/clientset/versioned"
 	"github.com/heptio/contour/internal/debug"
@@ -40,6 +42,7 @@ import (
 	"github.com/heptio/contour/internal/metrics"
 
 	"github.com/sirupsen/logrus"
+	grpcapi "google.golang.org/grpc"
 )
 
 var ingressrouteRootNamespaceFlag string
@@ -80,6 +83,16 @@ func main() {
 	kubeconfig := serve.Flag("kubeconfig", "path to kubeconfig (if not in running inside a cluster)").Default(filepath.Join(os.Getenv("HOME"), ".kube", "config")).String()
 	xdsAddr := serve.Flag("xds-address", "xDS gRPC API address").Default("127.0.0.1").String()
 	xdsPort := serve.Flag("xds-port", "xDS gRPC API port").Default("8001").Int()
+	xdsCompression := serve.Flag("xds-compression", "Gzip compress xDS gRPC API responses").Bool()
+	xdsMaxSendMsgSize := serve.Flag("xds-max-send-msg-size", "Largest xDS gRPC API message, in bytes, Contour will send, if not zero").Default("0").Int()
+	xdsTokenFile := serve.Flag("xds-token-file", "Require xDS clients to present the bearer token in this file").String()
+	xdsPushJitter := serve.Flag("xds-push-jitter", "Delay the first response on each xDS stream by a random duration of up to this value").Default("0s").Duration()
+	recordEndpoints := serve.Flag("record-endpoints", "Record endpoints informer events to this file for later replay").String()
+	maxClusters := serve.Flag("max-eds-clusters", "Evict the least recently updated EDS clusters beyond this limit; 0 disables the limit").Default("0").Int()
+	drainTerminatingPods := serve.Flag("drain-terminating-pods", "Watch pods and report endpoints of terminating pods as draining").Bool()
+	zoneAwareLocalities := serve.Flag("zone-aware-localities", "Watch nodes and group endpoints into localities by their node's region and zone labels").Bool()
+	serveStaleEndpoints := serve.Flag("serve-stale-endpoints", "Continue to serve the last known endpoints while disconnected from the API server").Bool()
+	edsStateFile := serve.Flag("eds-state-file", "Restore EDS state from this file on startup, and save it there periodically").String()
 
 	ch := contour.CacheHandler{
 		FieldLogger: log.WithField("context", "CacheHandler"),
@@ -179,9 +192,53 @@ func main() {
 		// Endpoints updates are handled directly by the EndpointsTranslator
 		// due to their high update rate and their orthogonal nature.
 		et := &contour.EndpointsTranslator{
-			FieldLogger: log.WithField("context", "endpointstranslator"),
+			FieldLogger:            log.WithField("context", "endpointstranslator"),
+			ServeStaleOnDisconnect: *serveStaleEndpoints,
+			MaxClusters:            *maxClusters,
+			Metrics:                metrics,
+		}
+		if *drainTerminatingPods {
+			et.Pods = k8s.WatchPods(&g, client, wl)
+		}
+		if *zoneAwareLocalities {
+			et.Nodes = k8s.WatchNodes(&g, client, wl)
+		}
+		debugsvc.Endpoints = et
+		if *edsStateFile != "" {
+			// restore before the endpoints informer starts, so the
+			// restored clusters are reconciled once it has synced.
+			buf, err := ioutil.ReadFile(*edsStateFile)
+			switch {
+			case os.IsNotExist(err):
+				// first start, nothing to restore.
+			case err != nil:
+				log.WithError(err).Warn("failed to read EDS state")
+			default:
+				if err := et.ImportState(buf); err != nil {
+					log.WithError(err).Warn("failed to restore EDS state")
+				}
+			}
+			g.Add(func(stop <-chan struct{}) error {
+				ticker := time.NewTicker(edsStateInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						saveState(log, *edsStateFile, et.ExportState())
+					case <-stop:
+						saveState(log, *edsStateFile, et.ExportState())
+						return nil
+					}
+				}
+			})
+		}
+		if *recordEndpoints != "" {
+			f, err := os.Create(*recordEndpoints)
+			check(err)
+			k8s.WatchEndpoints(&g, client, wl, contour.NewEndpointsRecorder(et.FieldLogger, f, et))
+		} else {
+			k8s.WatchEndpoints(&g, client, wl, et)
 		}
-		k8s.WatchEndpoints(&g, client, wl, et)
 
 		ch.Metrics = metrics
 		reh.Metrics = metrics
@@ -206,12 +263,34 @@ func main() {
 				routeType    = typePrefix + "RouteConfiguration"
 				listenerType = typePrefix + "Listener"
 			)
+			var opts []grpcapi.ServerOption
+			if *xdsMaxSendMsgSize > 0 {
+				opts = append(opts, grpc.MaxSendMsgSize(*xdsMaxSendMsgSize))
+			}
+			if *xdsTokenFile != "" {
+				token, err := ioutil.ReadFile(*xdsTokenFile)
+				if err != nil {
+					return err
+				}
+				bearer := strings.TrimSpace(string(token))
+				if bearer == "" {
+					return fmt.Errorf("xDS token file %q is empty", *xdsTokenFile)
+				}
+				opts = append(opts, grpc.TokenAuth(bearer)...)
+			}
+			options := []grpc.Option{
+				grpc.ServerOptions(opts...),
+				grpc.PushJitter(*xdsPushJitter),
+			}
+			if *xdsCompression {
+				options = append(options, grpc.Compression())
+			}
 			s := grpc.NewAPI(log, map[string]grpc.Cache{
 				clusterType:  &ch.ClusterCache,
 				routeType:    &ch.RouteCache,
 				listenerType: &ch.ListenerCache,
 				endpointType: et,
-			})
+			}, options...)
 			log.Println("started")
 			defer log.Println("stopped")
 			return s.Serve(l)
@@ -223,6 +302,25 @@ func main() {
 	}
 }
 
+// edsStateInterval is how often the --eds-state-file is saved.
+const edsStateInterval = 30 * time.Second
+
+// saveState writes state to path, replacing its contents atomically
+// so a crash while saving never leaves a partial state file.
+func saveState(log logrus.FieldLogger, path string, state []byte) {
+	if state == nil {
+		return // ExportState has logged the error.
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, state, 0644); err != nil {
+		log.WithError(err).Warn("failed to save EDS state")
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.WithError(err).Warn("failed to save EDS state")
+	}
+}
+
 func newClient(kubeconfig string, inCluster bool) (*kubernetes.Clientset, *clientset.Clientset) {
 	var err error
 	var config *rest.Config
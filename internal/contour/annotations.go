@@ -29,6 +29,12 @@ const (
 	annotationRequestTimeout  = "contour.heptio.com/request-timeout"
 	annotationWebsocketRoutes = "contour.heptio.com/websocket-routes"
 
+	annotationFailoverAddresses    = "contour.heptio.com/failover-addresses"
+	annotationFailoverPriority     = "contour.heptio.com/failover-priority"
+	annotationEndpointHealthStatus = "contour.heptio.com/endpoint-health-status"
+	annotationUpstreamSNI          = "contour.heptio.com/upstream-sni"
+	annotationHealthCheckPort      = "contour.heptio.com/health-check-port"
+
 	// By default envoy applies a 15 second timeout to all backend requests.
 	// The explicit value 0 turns off the timeout, implying "never time out"
 	// https://www.envoyproxy.io/docs/envoy/v1.5.0/api-v2/rds.proto#routeaction
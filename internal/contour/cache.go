@@ -14,6 +14,7 @@
 package contour
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
@@ -36,6 +37,14 @@ func (c *cache) insert(name string, value proto.Message) {
 	c.mu.Unlock()
 }
 
+// get returns the value stored in the cache with the key name.
+func (c *cache) get(name string) (proto.Message, bool) {
+	c.mu.Lock()
+	v, ok := c.entries[name]
+	c.mu.Unlock()
+	return v, ok
+}
+
 // remote removes a value from the cache.
 func (c *cache) remove(name string) {
 	c.mu.Lock()
@@ -69,6 +78,17 @@ func (c *clusterLoadAssignmentCache) Add(assignments ...*v2.ClusterLoadAssignmen
 	}
 }
 
+// Values returns a slice of the ClusterLoadAssignments stored in the
+// cache, ordered by name, so that two caches holding the same entries
+// produce the same EDS response.
+func (c *clusterLoadAssignmentCache) Values(filter func(string) bool) []proto.Message {
+	values := c.cache.Values(filter)
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].(*v2.ClusterLoadAssignment).ClusterName < values[j].(*v2.ClusterLoadAssignment).ClusterName
+	})
+	return values
+}
+
 // Remove removes the named entry from the cache. If the entry
 // is not present in the cache, the operation is a no-op.
 func (c *clusterLoadAssignmentCache) Remove(names ...string) {
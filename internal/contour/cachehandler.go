@@ -80,6 +80,14 @@ func (ch *CacheHandler) updateClusters(v dag.Visitable) {
 	cv := clusterVisitor{
 		ClusterCache: &ch.ClusterCache,
 		Visitable:    v,
+		collision: func(name, first, second string) {
+			if ch.FieldLogger != nil {
+				ch.WithField("cluster", name).WithField("first", first).WithField("second", second).Error("cluster name collision, skipping second service")
+			}
+			if ch.Metrics != nil {
+				ch.Metrics.IncClusterNameCollisions()
+			}
+		},
 	}
 	ch.clusterCache.Update(cv.Visit())
 }
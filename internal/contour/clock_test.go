@@ -0,0 +1,81 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// fakeClock is a Clock whose time only moves when Advance is called.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now: time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward by d.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func TestEndpointsTranslatorClock(t *testing.T) {
+	clock := newFakeClock()
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+		Clock:       clock,
+	}
+	start := clock.Now()
+	simple := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(simple)
+	clock.Advance(time.Minute)
+	et.OnAdd(endpoints("default", "other", v1.EndpointSubset{
+		Addresses: addresses("10.0.0.1"),
+		Ports:     ports(80),
+	}))
+	clock.Advance(time.Minute)
+	et.OnUpdate(simple, endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.25"),
+		Ports:     ports(8080),
+	}))
+
+	// each cluster records when it was last updated by the clock.
+	want := map[string]time.Time{
+		"default/simple": start.Add(2 * time.Minute),
+		"default/other":  start.Add(time.Minute),
+	}
+	if !reflect.DeepEqual(want, et.updated) {
+		t.Fatalf("expected: %v, got: %v", want, et.updated)
+	}
+}
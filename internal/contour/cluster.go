@@ -111,11 +111,17 @@ type clusterVisitor struct {
 	*ClusterCache
 	dag.Visitable
 
-	clusters map[string]*v2.Cluster
+	// collision, if set, is called when two services with different
+	// unshortened names are given the same cluster name.
+	collision func(name, first, second string)
+
+	clusters  map[string]*v2.Cluster
+	originals map[string]string // cluster name to unshortened name
 }
 
 func (v *clusterVisitor) Visit() map[string]*v2.Cluster {
 	v.clusters = make(map[string]*v2.Cluster)
+	v.originals = make(map[string]string)
 	v.Visitable.Visit(v.visit)
 	return v.clusters
 }
@@ -130,10 +136,16 @@ func (v *clusterVisitor) visit(vertex dag.Vertex) {
 
 func (v *clusterVisitor) edscluster(svc *dag.Service) {
 	name := clustername(svc)
+	original := strings.Join(clusternameParts(svc), "/")
 	if _, ok := v.clusters[name]; ok {
-		// already created this cluster via another edge. skip it.
+		// already created this cluster via another edge, or another
+		// service has been shortened to the same name. skip it.
+		if first := v.originals[name]; first != original && v.collision != nil {
+			v.collision(name, first, original)
+		}
 		return
 	}
+	v.originals[name] = original
 
 	c := &v2.Cluster{
 		Name:             name,
@@ -180,6 +192,12 @@ func (v *clusterVisitor) edscluster(svc *dag.Service) {
 
 // clustername returns the name of the CDS cluster for this service.
 func clustername(s *dag.Service) string {
+	return hashname(60, clusternameParts(s)...)
+}
+
+// clusternameParts returns the components of the unshortened name of
+// the CDS cluster for this service.
+func clusternameParts(s *dag.Service) []string {
 	buf := s.LoadBalancerStrategy
 	if hc := s.HealthCheck; hc != nil {
 		if hc.TimeoutSeconds > 0 {
@@ -198,9 +216,7 @@ func clustername(s *dag.Service) string {
 	}
 
 	hash := sha1.Sum([]byte(buf))
-	ns := s.Namespace()
-	name := s.Name()
-	return hashname(60, ns, name, strconv.Itoa(int(s.Port)), fmt.Sprintf("%x", hash[:5]))
+	return []string{s.Namespace(), s.Name(), strconv.Itoa(int(s.Port)), fmt.Sprintf("%x", hash[:5])}
 }
 
 func edslbstrategy(lbStrategy string) v2.Cluster_LbPolicy {
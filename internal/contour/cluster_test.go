@@ -937,6 +937,52 @@ func TestClustername(t *testing.T) {
 	}
 }
 
+func TestClusterVisitorNameCollision(t *testing.T) {
+	// these two services have different names, but are shortened
+	// to the same cluster name, it-is-a--073098/must-be--073098/9999/da39a3ee5e.
+	s1 := &dag.Service{
+		Object: service("it-is-a-truth-universally-acknowledged-that-a-single-man-in-possession-of-a-good-fortune", "must-be-in-want-of-a-wife-1532"),
+		ServicePort: &v1.ServicePort{
+			Protocol: "TCP",
+			Port:     9999,
+		},
+	}
+	s2 := &dag.Service{
+		Object: service("it-is-a-truth-universally-acknowledged-that-a-single-man-in-possession-of-a-good-fortune", "must-be-in-want-of-a-wife-1977"),
+		ServicePort: &v1.ServicePort{
+			Protocol: "TCP",
+			Port:     9999,
+		},
+	}
+	if clustername(s1) != clustername(s2) {
+		t.Fatalf("expected %q and %q to collide", clustername(s1), clustername(s2))
+	}
+
+	var collisions []string
+	v := clusterVisitor{
+		collision: func(name, first, second string) {
+			collisions = append(collisions, name, first, second)
+		},
+		clusters:  make(map[string]*v2.Cluster),
+		originals: make(map[string]string),
+	}
+	v.edscluster(s1)
+	v.edscluster(s1) // the same service via another edge is not a collision
+	if len(collisions) != 0 {
+		t.Fatalf("unexpected collision: %v", collisions)
+	}
+
+	v.edscluster(s2)
+	want := []string{
+		"it-is-a--073098/must-be--073098/9999/da39a3ee5e",
+		"it-is-a-truth-universally-acknowledged-that-a-single-man-in-possession-of-a-good-fortune/must-be-in-want-of-a-wife-1532/9999/da39a3ee5e",
+		"it-is-a-truth-universally-acknowledged-that-a-single-man-in-possession-of-a-good-fortune/must-be-in-want-of-a-wife-1977/9999/da39a3ee5e",
+	}
+	if diff := cmp.Diff(want, collisions); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func uint32t(v int) *types.UInt32Value {
 	return &types.UInt32Value{Value: uint32(v)}
 }
@@ -14,25 +14,228 @@
 package contour
 
 import (
+	"hash/fnv"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/heptio/contour/internal/metrics"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listers "k8s.io/client-go/listers/core/v1"
 	_cache "k8s.io/client-go/tools/cache"
 )
 
+// The node labels from which an endpoint's Locality is taken. The
+// failure-domain labels are consulted when the topology labels,
+// which replace them, are absent.
+const (
+	labelTopologyRegion      = "topology.kubernetes.io/region"
+	labelTopologyZone        = "topology.kubernetes.io/zone"
+	labelFailureDomainRegion = "failure-domain.beta.kubernetes.io/region"
+	labelFailureDomainZone   = "failure-domain.beta.kubernetes.io/zone"
+)
+
 // A EndpointsTranslator translates Kubernetes Endpoints objects into Envoy
 // ClusterLoadAssignment objects.
 type EndpointsTranslator struct {
 	logrus.FieldLogger
 	clusterLoadAssignmentCache
 	Cond
+
+	// CLAMutator, if set, is called with each ClusterLoadAssignment
+	// immediately before it is added to the cache. Mutations must be
+	// deterministic; a mutator which produces different output for the
+	// same input will cause spurious updates to be sent to Envoy.
+	CLAMutator func(*v2.ClusterLoadAssignment)
+
+	// ClusterNamePolicy controls the handling of cluster names which
+	// contain characters Envoy does not accept. See validClusterName.
+	// If not set, defaults to RejectInvalidClusterNames.
+	ClusterNamePolicy ClusterNamePolicy
+
+	// StripClusterNamePrefix, if set, is removed from the start of any
+	// cluster name it prefixes, for example "kube-system/" publishes
+	// "kube-system/kube-dns" as "kube-dns". Contour's own CDS clusters
+	// reference the unstripped name, so this is only useful for clusters
+	// defined outside of Contour, such as in Envoy's bootstrap config.
+	StripClusterNamePrefix string
+
+	// LocalityPerSubset, if true, places the endpoints of each
+	// EndpointSubset in their own LocalityLbEndpoints group rather than
+	// flattening every subset into a single group per port. Subsets carry
+	// no topology information so each group has the default locality;
+	// a CLAMutator may be used to assign one.
+	LocalityPerSubset bool
+
+	// DefaultHealthStatus is the health status applied to each emitted
+	// endpoint. If not set, defaults to core.HealthStatus_UNKNOWN, which
+	// Envoy treats as healthy until active health checking says otherwise.
+	// May be overridden by the contour.heptio.com/endpoint-health-status
+	// annotation.
+	DefaultHealthStatus core.HealthStatus
+
+	// Pods, if set, is used to look up the pod behind each address.
+	// Addresses whose pod is terminating are emitted as DRAINING, so
+	// Envoy stops sending them new requests before they are removed
+	// from the Endpoints object, and a pod's upstream-sni annotation
+	// takes precedence over its Endpoints object's.
+	Pods listers.PodLister
+
+	// Nodes, if set, is used to look up the node behind each address.
+	// Endpoints are grouped into one LocalityLbEndpoints per zone, with
+	// the Locality's region and zone taken from the node's topology
+	// labels, so Envoy can route with zone awareness. Addresses whose
+	// node is unknown, or unlabelled, share a group without a Locality.
+	// Nodes takes precedence over LocalityPerSubset.
+	Nodes listers.NodeLister
+
+	// FailoverPriority is the priority at which addresses listed in an
+	// Endpoints object's contour.heptio.com/failover-addresses annotation
+	// are placed. Envoy only sends traffic to them when the endpoints at
+	// priority 0 are unavailable. If not set, defaults to 1.
+	// May be overridden by the contour.heptio.com/failover-priority annotation.
+	// Only the order of FailoverPriority and NotReadyPriority matters;
+	// the published priorities are renumbered to be contiguous from 0.
+	FailoverPriority uint32
+
+	// ConsolidatePorts, if true, publishes the endpoints of every port
+	// of a service in a single ClusterLoadAssignment named for the
+	// service alone, rather than one ClusterLoadAssignment per named
+	// port. The name of each endpoint's port is recorded in its
+	// metadata, under the envoy.lb filter namespace as "port", so a
+	// cluster may select the endpoints of one port with a subset load
+	// balancer. Contour's own CDS clusters are per port, so this is only
+	// useful for clusters defined outside of Contour.
+	ConsolidatePorts bool
+
+	// EmitEmptyClusterLoadAssignment, if true, publishes a
+	// ClusterLoadAssignment with no endpoints when a service is scaled
+	// to zero, rather than withdrawing the ClusterLoadAssignment. Envoy
+	// then clears the cluster's endpoints immediately instead of
+	// continuing to use the last ClusterLoadAssignment it received.
+	// Deleting the Endpoints object always withdraws its clusters.
+	EmitEmptyClusterLoadAssignment bool
+
+	// NotReadyPriority, if non-zero, publishes the not ready addresses
+	// of each Endpoints object at this priority, below the ready
+	// addresses at priority 0, so Envoy only sends them traffic when
+	// too few ready endpoints remain. If zero, not ready addresses are
+	// not published.
+	NotReadyPriority uint32
+
+	// IncludeNotReadyEndpoints, if true, publishes the not ready
+	// addresses of each Endpoints object as UNHEALTHY, and the ready
+	// addresses as HEALTHY, so Envoy's health checking and outlier
+	// detection see the full set of endpoints. Not ready addresses are
+	// published alongside the ready addresses unless NotReadyPriority
+	// is also set. The ready addresses' health status may still be
+	// overridden by the contour.heptio.com/endpoint-health-status
+	// annotation.
+	IncludeNotReadyEndpoints bool
+
+	// OrderEndpointsByHash, if true, orders the endpoints within each
+	// LocalityLbEndpoints group by a hash of their address and port
+	// rather than by address. Both orders are the same for the same
+	// endpoints, but the hash scatters neighbouring addresses rather
+	// than clustering them, which suits the ring hash and Maglev load
+	// balancers, whose placement depends on endpoint order.
+	OrderEndpointsByHash bool
+
+	// MaxClusters, if positive, is a soft limit on the number of
+	// ClusterLoadAssignments published. When it is exceeded the least
+	// recently updated clusters are evicted until the limit is met. An
+	// evicted cluster is published again on its next update. This is a
+	// defence against runaway numbers of short lived services; under
+	// normal operation the limit should never be reached.
+	MaxClusters int
+
+	// Clock is used by time based features.
+	// If not set, defaults to the wall clock.
+	Clock Clock
+
+	// ServeStaleOnDisconnect, if true, continues to serve the last known
+	// ClusterLoadAssignments while the Endpoints informer is disconnected
+	// from the API server, and reconciles them with the Endpoints objects
+	// listed on reconnection. See Disconnected and Reconnected.
+	ServeStaleOnDisconnect bool
+
+	// Metrics, if set, records EndpointsTranslator metrics.
+	Metrics *metrics.Metrics
+
+	mu sync.Mutex // protects the fields below
+
+	// paused holds the recorded state of each paused cluster.
+	paused map[string]*pausedCluster
+
+	// disconnected is true while the Endpoints informer is
+	// disconnected and ServeStaleOnDisconnect is set.
+	disconnected bool
+
+	// held records the latest state of each cluster changed while
+	// disconnected. A nil value records the cluster's removal.
+	held map[string]*v2.ClusterLoadAssignment
+
+	// subscribers receive a ClusterChange for each published change.
+	subscribers map[chan ClusterChange]struct{}
+
+	// countSubscribers receive a ClusterCount for each published change.
+	countSubscribers map[chan ClusterCount]struct{}
+
+	// version counts the changes published.
+	version uint64
+
+	// updated records when each published cluster was last updated.
+	updated map[string]time.Time
+
+	// emptied records, by service, the empty ClusterLoadAssignments
+	// published by EmitEmptyClusterLoadAssignment.
+	emptied map[string][]string
+
+	// sources records the namespace and name, as "namespace/name", of
+	// the Endpoints object from which each published cluster was
+	// translated.
+	sources map[string]string
+
+	// collided records the published clusters whose name has been
+	// produced by more than one Endpoints object.
+	collided map[string]bool
+
+	// imported records the clusters restored by ImportState which have
+	// not since changed, until the Endpoints informer has synced.
+	imported map[string]bool
 }
 
+// pausedCluster records the latest state of a paused cluster.
+type pausedCluster struct {
+	cla     *v2.ClusterLoadAssignment // nil if the cluster was removed
+	changed bool
+}
+
+// ClusterNamePolicy controls how the EndpointsTranslator handles a
+// cluster name which contains disallowed characters.
+type ClusterNamePolicy int
+
+const (
+	// RejectInvalidClusterNames logs an error and does not publish
+	// the ClusterLoadAssignment.
+	RejectInvalidClusterNames ClusterNamePolicy = iota
+
+	// SanitizeInvalidClusterNames replaces each disallowed character
+	// with an underscore and publishes the ClusterLoadAssignment under
+	// the sanitized name.
+	SanitizeInvalidClusterNames
+)
+
 func (e *EndpointsTranslator) OnAdd(obj interface{}) {
 	switch obj := obj.(type) {
 	case *v1.Endpoints:
@@ -94,6 +297,10 @@ func (e *EndpointsTranslator) recomputeClusterLoadAssignment(oldep, newep *v1.En
 
 	defer e.Notify()
 
+	// scaledToZero is true if newep is an update which leaves the
+	// service with no ready endpoints, rather than a deletion.
+	scaledToZero := newep != nil
+
 	if oldep == nil {
 		oldep = &v1.Endpoints{
 			ObjectMeta: newep.ObjectMeta,
@@ -106,11 +313,254 @@ func (e *EndpointsTranslator) recomputeClusterLoadAssignment(oldep, newep *v1.En
 		}
 	}
 
+	// iterate all the defined clusters and add or update them.
+	clas := e.translate(newep, true)
+	for _, c := range clas {
+		e.add(c, EndpointsChanged)
+		e.recordSource(c.ClusterName, newep)
+	}
+	scaledToZero = scaledToZero && len(clas) == 0
+	if scaledToZero {
+		if n := e.publishedEndpoints(oldep); n > 0 {
+			e.scaledToZero(newep, n)
+		}
+	}
+
+	// withdraw any empty ClusterLoadAssignments published when this
+	// service was last scaled to zero which have not been replaced.
+	service := servicename(oldep.ObjectMeta, "")
+	for _, name := range e.takeEmptied(service) {
+		if !published(clas, name) {
+			e.remove(name, EndpointsChanged)
+		}
+	}
+
+	// iterate over the ports in the old spec, remove any that are not
+	// mentioned in clas
+	for _, s := range oldep.Subsets {
+		if !e.publishes(s) {
+			continue
+		}
+		for _, p := range s.Ports {
+			// if this endpoint's service's port has a name, then the endpoint
+			// controller will apply the name here. The name may appear once per subset.
+			portname := e.clusterPort(p.Name)
+			if _, ok := clas[portname]; !ok {
+				// port is not present in the list added / updated, so remove it
+				name, ok := e.clusterName(servicename(oldep.ObjectMeta, portname))
+				switch {
+				case !ok:
+					// never published.
+				case scaledToZero && e.EmitEmptyClusterLoadAssignment:
+					e.add(&v2.ClusterLoadAssignment{ClusterName: name}, EndpointsChanged)
+					e.recordSource(name, newep)
+					e.recordEmptied(service, name)
+				default:
+					e.remove(name, EndpointsChanged)
+				}
+			}
+		}
+	}
+}
+
+// publishedEndpoints returns the number of endpoints currently published
+// for the ports of ep.
+func (e *EndpointsTranslator) publishedEndpoints(ep *v1.Endpoints) int {
+	seen := make(map[string]bool)
+	n := 0
+	for _, s := range ep.Subsets {
+		for _, p := range s.Ports {
+			name, ok := e.clusterName(servicename(ep.ObjectMeta, e.clusterPort(p.Name)))
+			if !ok || seen[name] {
+				continue
+			}
+			seen[name] = true
+			if cla, ok := e.get(name); ok {
+				for _, lle := range cla.(*v2.ClusterLoadAssignment).Endpoints {
+					n += len(lle.LbEndpoints)
+				}
+			}
+		}
+	}
+	return n
+}
+
+// scaledToZero logs, and records, that the update ep left its service,
+// which previously had n endpoints, with none.
+func (e *EndpointsTranslator) scaledToZero(ep *v1.Endpoints, n int) {
+	e.WithFields(logrus.Fields{
+		"namespace":          ep.Namespace,
+		"name":               ep.Name,
+		"resource_version":   ep.ResourceVersion,
+		"previous_endpoints": n,
+	}).Warn("service scaled to zero endpoints")
+	if e.Metrics != nil {
+		e.Metrics.IncScaleToZero()
+	}
+}
+
+// publishes returns true if s has addresses which would be published.
+func (e *EndpointsTranslator) publishes(s v1.EndpointSubset) bool {
+	return len(s.Addresses) > 0 || (e.publishesNotReady() && len(s.NotReadyAddresses) > 0)
+}
+
+// publishesNotReady returns true if not ready addresses are published.
+func (e *EndpointsTranslator) publishesNotReady() bool {
+	return e.NotReadyPriority > 0 || e.IncludeNotReadyEndpoints
+}
+
+// lbendpoint returns the LbEndpoint for address a on port p of ep. If a
+// is malformed, false is returned.
+func (e *EndpointsTranslator) lbendpoint(ep *v1.Endpoints, a v1.EndpointAddress, p v1.EndpointPort, opts endpointsOptions) (endpoint.LbEndpoint, bool) {
+	if a.IP == "" {
+		// Envoy rejects the whole ClusterLoadAssignment if
+		// any endpoint has an empty address.
+		if opts.report {
+			e.malformedAddress(ep, a)
+		}
+		return endpoint.LbEndpoint{}, false
+	}
+	lb := lbendpoint(a.IP, p.Port)
+	lb.HealthStatus = opts.healthStatus
+	if opts.healthCheckPort > 0 {
+		lb.Endpoint.HealthCheckConfig = &endpoint.Endpoint_HealthCheckConfig{
+			PortValue: opts.healthCheckPort,
+		}
+	}
+	pod := e.pod(a)
+	if pod != nil && pod.DeletionTimestamp != nil {
+		// the pod is terminating.
+		lb.HealthStatus = core.HealthStatus_DRAINING
+	}
+	if sni := upstreamSNI(ep, pod); sni != "" {
+		setMetadata(&lb, "envoy.transport_socket_match", "sni", sni)
+	}
+	if e.ConsolidatePorts && p.Name != "" {
+		setMetadata(&lb, "envoy.lb", "port", p.Name)
+	}
+	return lb, true
+}
+
+// published returns true if clas contains a cluster called name.
+func published(clas map[string]*v2.ClusterLoadAssignment, name string) bool {
+	for _, c := range clas {
+		if c.ClusterName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// recordSource records that the cluster called name was translated
+// from ep. StripClusterNamePrefix and SanitizeInvalidClusterNames can
+// give the clusters of different Endpoints objects the same name, in
+// which case each replaces the other's ClusterLoadAssignment. The first
+// time this happens to a cluster it is logged and counted.
+func (e *EndpointsTranslator) recordSource(name string, ep *v1.Endpoints) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.sources == nil {
+		e.sources = make(map[string]string)
+	}
+	source := ep.Namespace + "/" + ep.Name
+	if prev, ok := e.sources[name]; ok && prev != source && !e.collided[name] {
+		if e.collided == nil {
+			e.collided = make(map[string]bool)
+		}
+		e.collided[name] = true
+		e.WithField("cluster", name).WithField("first", prev).WithField("second", source).Warn("cluster name collision, each service replaces the endpoints of the other")
+		if e.Metrics != nil {
+			e.Metrics.IncEndpointsClusterNameConflicts()
+		}
+	}
+	e.sources[name] = source
+}
+
+// PurgeNamespace withdraws every cluster translated from an Endpoints
+// object in namespace ns, regardless of how its name was rewritten by
+// StripClusterNamePrefix or ClusterNamePolicy, including the empty
+// ClusterLoadAssignments published by EmitEmptyClusterLoadAssignment.
+// The Kubernetes objects are not modified; the next event for each
+// Endpoints object restores its clusters. Clusters restored by
+// ImportState keep the namespace recorded by ExportState.
+func (e *EndpointsTranslator) PurgeNamespace(ns string) {
+	prefix := ns + "/"
+	e.mu.Lock()
+	for name, source := range e.sources {
+		if strings.HasPrefix(source, prefix) {
+			e.set(name, nil, NamespacePurged)
+		}
+	}
+	for service := range e.emptied {
+		if strings.HasPrefix(service, prefix) {
+			delete(e.emptied, service)
+		}
+	}
+	e.mu.Unlock()
+	e.Notify()
+}
+
+// recordEmptied records that an empty ClusterLoadAssignment called
+// name was published for service.
+func (e *EndpointsTranslator) recordEmptied(service, name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.emptied == nil {
+		e.emptied = make(map[string][]string)
+	}
+	e.emptied[service] = append(e.emptied[service], name)
+}
+
+// takeEmptied returns, and forgets, the empty ClusterLoadAssignments
+// published for service.
+func (e *EndpointsTranslator) takeEmptied(service string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := e.emptied[service]
+	delete(e.emptied, service)
+	return names
+}
+
+// forgetEmptied removes name from the empty ClusterLoadAssignments
+// recorded by recordEmptied. Callers must hold e.mu.
+func (e *EndpointsTranslator) forgetEmptied(name string) {
+	for service, names := range e.emptied {
+		for i, n := range names {
+			if n == name {
+				names = append(names[:i], names[i+1:]...)
+				break
+			}
+		}
+		if len(names) == 0 {
+			delete(e.emptied, service)
+		} else {
+			e.emptied[service] = names
+		}
+	}
+}
+
+// translate returns the ClusterLoadAssignments for ep, keyed by port
+// name. Clusters whose name is rejected by ClusterNamePolicy are omitted.
+// translate does not modify the published ClusterLoadAssignments. If
+// report is true, invalid annotations, addresses, and cluster names are
+// logged and recorded in e's Metrics, otherwise they are skipped silently.
+func (e *EndpointsTranslator) translate(ep *v1.Endpoints, report bool) map[string]*v2.ClusterLoadAssignment {
 	clas := make(map[string]*v2.ClusterLoadAssignment)
+	opts := e.options(ep, report)
+	failover := failoverAddresses(ep)
+	// lower holds, by port name then priority, the endpoints which
+	// are published below priority 0.
+	lower := make(map[string]map[uint32][]endpoint.LbEndpoint)
+	demote := func(portname string, priority uint32, lb endpoint.LbEndpoint) {
+		if lower[portname] == nil {
+			lower[portname] = make(map[uint32][]endpoint.LbEndpoint)
+		}
+		lower[portname][priority] = append(lower[portname][priority], lb)
+	}
 	// add or update endpoints
-	for _, s := range newep.Subsets {
-		// skip any subsets that don't have ready addresses
-		if len(s.Addresses) == 0 {
+	for _, s := range ep.Subsets {
+		// skip any subsets that don't have addresses to publish
+		if !e.publishes(s) {
 			continue
 		}
 
@@ -119,38 +569,732 @@ func (e *EndpointsTranslator) recomputeClusterLoadAssignment(oldep, newep *v1.En
 
 			// if this endpoint's service's port has a name, then the endpoint
 			// controller will apply the name here. The name may appear once per subset.
-			portname := p.Name
+			// Endpoints are grouped into a ClusterLoadAssignment by port name, not
+			// number, as a named target port may resolve to a different numeric
+			// port on each pod. Each endpoint retains its own numeric port.
+			portname := e.clusterPort(p.Name)
 			cla, ok := clas[portname]
 			if !ok {
-				cla = clusterloadassignment(servicename(newep.ObjectMeta, portname))
+				cla = clusterloadassignment(servicename(ep.ObjectMeta, portname))
 				clas[portname] = cla
 			}
+			if e.Nodes == nil && e.LocalityPerSubset && len(cla.Endpoints[len(cla.Endpoints)-1].LbEndpoints) > 0 {
+				// start a new locality group for this subset.
+				cla.Endpoints = append(cla.Endpoints, endpoint.LocalityLbEndpoints{})
+			}
+			group := func(a v1.EndpointAddress) *endpoint.LocalityLbEndpoints {
+				if e.Nodes != nil {
+					return localityGroup(cla, e.locality(a))
+				}
+				return &cla.Endpoints[len(cla.Endpoints)-1]
+			}
 			for _, a := range s.Addresses {
-				cla.Endpoints[0].LbEndpoints = append(cla.Endpoints[0].LbEndpoints, lbendpoint(a.IP, p.Port))
+				lb, ok := e.lbendpoint(ep, a, p, opts)
+				if !ok {
+					continue
+				}
+				if failover[a.IP] {
+					demote(portname, opts.failoverPriority, lb)
+					continue
+				}
+				lle := group(a)
+				lle.LbEndpoints = append(lle.LbEndpoints, lb)
+			}
+			if e.publishesNotReady() {
+				for _, a := range s.NotReadyAddresses {
+					lb, ok := e.lbendpoint(ep, a, p, opts)
+					if !ok {
+						continue
+					}
+					if e.IncludeNotReadyEndpoints && lb.HealthStatus != core.HealthStatus_DRAINING {
+						lb.HealthStatus = core.HealthStatus_UNHEALTHY
+					}
+					if e.NotReadyPriority > 0 {
+						demote(portname, e.NotReadyPriority, lb)
+						continue
+					}
+					lle := group(a)
+					lle.LbEndpoints = append(lle.LbEndpoints, lb)
+				}
 			}
 		}
 	}
 
-	// iterate all the defined clusters and add or update them.
-	for _, c := range clas {
-		e.Add(c)
+	// failover and not ready endpoints form their own, lower priority,
+	// groups, one per priority. Envoy rejects a ClusterLoadAssignment
+	// whose priorities are not contiguous from 0, so the groups are
+	// renumbered in order, leaving no empty levels between them.
+	for portname, groups := range lower {
+		var priorities []int
+		for priority := range groups {
+			priorities = append(priorities, int(priority))
+		}
+		sort.Ints(priorities)
+		cla := clas[portname]
+		for i, priority := range priorities {
+			cla.Endpoints = append(cla.Endpoints, endpoint.LocalityLbEndpoints{
+				LbEndpoints: groups[uint32(priority)],
+				Priority:    uint32(i + 1),
+			})
+		}
 	}
 
-	// iterate over the ports in the old spec, remove any that are not
-	// mentioned in clas
-	for _, s := range oldep.Subsets {
-		if len(s.Addresses) == 0 {
+	// finalise the name, and order, of each cluster.
+	for portname, c := range clas {
+		name, ok := e.clusterName(c.ClusterName)
+		if !ok {
+			if report {
+				e.WithField("cluster", c.ClusterName).Error("cluster name contains invalid characters, skipping")
+			}
+			delete(clas, portname)
 			continue
 		}
-		for _, p := range s.Ports {
-			// if this endpoint's service's port has a name, then the endpoint
-			// controller will apply the name here. The name may appear once per subset.
-			portname := p.Name
-			if _, ok := clas[portname]; !ok {
-				// port is not present in the list added / updated, so remove it
-				e.Remove(servicename(oldep.ObjectMeta, portname))
+		c.ClusterName = name
+		for _, lle := range c.Endpoints {
+			if e.OrderEndpointsByHash {
+				sortByHash(lle.LbEndpoints)
+			} else {
+				sortByAddress(lle.LbEndpoints)
 			}
 		}
+		sortLocalities(c.Endpoints)
+		if e.CLAMutator != nil {
+			e.CLAMutator(c)
+		}
+	}
+	return clas
+}
+
+// DryRun returns, ordered by name, the ClusterLoadAssignments ep would
+// produce under the current configuration, without publishing them.
+// Problems with ep are neither logged nor recorded in e's Metrics.
+func (e *EndpointsTranslator) DryRun(ep *v1.Endpoints) []*v2.ClusterLoadAssignment {
+	var clas []*v2.ClusterLoadAssignment
+	for _, c := range e.translate(ep, false) {
+		clas = append(clas, c)
+	}
+	sort.Slice(clas, func(i, j int) bool {
+		return clas[i].ClusterName < clas[j].ClusterName
+	})
+	return clas
+}
+
+// PauseCluster stops changes to the named cluster from being published.
+// Changes to a paused cluster are recorded, and the latest state is
+// published when the cluster is resumed. Other clusters are unaffected.
+func (e *EndpointsTranslator) PauseCluster(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.paused == nil {
+		e.paused = make(map[string]*pausedCluster)
+	}
+	if _, ok := e.paused[name]; !ok {
+		e.paused[name] = new(pausedCluster)
+	}
+}
+
+// ResumeCluster resumes publishing changes to the named cluster, flushing
+// any change recorded while it was paused. If the cluster is not paused,
+// ResumeCluster is a no-op.
+func (e *EndpointsTranslator) ResumeCluster(name string) {
+	e.mu.Lock()
+	p, ok := e.paused[name]
+	delete(e.paused, name)
+	if ok && p.changed {
+		e.set(name, p.cla, ClusterResumed)
+	}
+	e.mu.Unlock()
+
+	if ok && p.changed {
+		e.Notify()
+	}
+}
+
+// Disconnected is called when the Endpoints informer loses its connection
+// to the API server. If ServeStaleOnDisconnect is set, changes are recorded
+// but not published until Reconnected is called.
+func (e *EndpointsTranslator) Disconnected(err error) {
+	e.WithError(err).WithField("serve_stale", e.ServeStaleOnDisconnect).Error("endpoints informer disconnected")
+	if e.Metrics != nil {
+		e.Metrics.IncEndpointsInformerDisconnects()
+	}
+	if !e.ServeStaleOnDisconnect {
+		return
+	}
+	e.mu.Lock()
+	e.disconnected = true
+	e.mu.Unlock()
+}
+
+// Reconnected is called when the Endpoints informer has reestablished its
+// connection to the API server. If the informer relisted, objs holds every
+// Endpoints object listed, and the published ClusterLoadAssignments are
+// reconciled with them before the relisted events arrive; changes recorded
+// while disconnected are superseded. Otherwise the informer resumed its
+// watch, and any changes recorded while disconnected are published.
+func (e *EndpointsTranslator) Reconnected(objs []interface{}) {
+	e.Info("endpoints informer reconnected")
+	var live map[string]*v2.ClusterLoadAssignment
+	if objs != nil {
+		live = make(map[string]*v2.ClusterLoadAssignment)
+		for _, obj := range objs {
+			if ep, ok := obj.(*v1.Endpoints); ok {
+				for _, cla := range e.translate(ep, false) {
+					live[cla.ClusterName] = cla
+				}
+			}
+		}
+	}
+
+	e.mu.Lock()
+	if !e.disconnected {
+		e.mu.Unlock()
+		return
+	}
+	e.disconnected = false
+	held := e.held
+	e.held = nil
+	if live == nil {
+		for name, cla := range held {
+			e.set(name, cla, InformerReconnected)
+		}
+	} else {
+		for name, cla := range live {
+			if cur, ok := e.get(name); !ok || !proto.Equal(cur, cla) {
+				e.set(name, cla, InformerReconnected)
+			}
+		}
+		for name := range e.updated {
+			if _, ok := live[name]; ok {
+				continue
+			}
+			// empty ClusterLoadAssignments are withdrawn when
+			// their Endpoints object is deleted.
+			if cur, ok := e.get(name); ok && len(cur.(*v2.ClusterLoadAssignment).Endpoints) > 0 {
+				e.set(name, nil, InformerReconnected)
+			}
+		}
+	}
+	e.mu.Unlock()
+	e.Notify()
+}
+
+// Synced is called once the Endpoints informer has listed every
+// Endpoints object, objs. Clusters restored by ImportState which have not
+// since changed, and which none of objs produces, are withdrawn.
+func (e *EndpointsTranslator) Synced(objs []interface{}) {
+	live := make(map[string]bool)
+	for _, obj := range objs {
+		if ep, ok := obj.(*v1.Endpoints); ok {
+			for _, cla := range e.translate(ep, false) {
+				live[cla.ClusterName] = true
+			}
+		}
+	}
+	e.mu.Lock()
+	for name := range e.imported {
+		if !live[name] {
+			e.set(name, nil, ImportReconciled)
+		}
+	}
+	e.imported = nil
+	e.mu.Unlock()
+	e.Notify()
+}
+
+// CheckClusters compares the published ClusterLoadAssignments with known,
+// the EDS service names referenced by CDS. It returns, and logs a warning
+// for, the names published without a CDS reference (unknown) and the CDS
+// references which have no published ClusterLoadAssignment (missing).
+func (e *EndpointsTranslator) CheckClusters(known []string) (unknown, missing []string) {
+	referenced := make(map[string]bool, len(known))
+	for _, name := range known {
+		referenced[name] = true
+	}
+	published := make(map[string]bool)
+	for _, v := range e.Values(func(string) bool { return true }) {
+		name := v.(*v2.ClusterLoadAssignment).ClusterName
+		published[name] = true
+		if !referenced[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	for name := range referenced {
+		if !published[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(unknown)
+	sort.Strings(missing)
+
+	if len(unknown) > 0 {
+		e.WithField("clusters", unknown).Warn("publishing endpoints for clusters unknown to CDS")
+	}
+	if len(missing) > 0 {
+		e.WithField("clusters", missing).Warn("CDS clusters have no published endpoints")
+	}
+	if e.Metrics != nil {
+		e.Metrics.SetEDSClusterMismatches(len(unknown), len(missing))
+	}
+	return unknown, missing
+}
+
+// ExportState returns the cached ClusterLoadAssignments, and the version of
+// the cache, serialised as a v2.DiscoveryResponse. The Endpoints object each
+// cluster was translated from is recorded in a trailing types.Struct. The
+// result may be passed to ImportState to restore the state of a new
+// EndpointsTranslator.
+func (e *EndpointsTranslator) ExportState() []byte {
+	e.Cond.mu.Lock()
+	version := e.Cond.last
+	e.Cond.mu.Unlock()
+
+	values := e.Values(func(string) bool { return true })
+	sources := &types.Struct{Fields: make(map[string]*types.Value)}
+	e.mu.Lock()
+	for name, source := range e.sources {
+		sources.Fields[name] = &types.Value{Kind: &types.Value_StringValue{StringValue: source}}
+	}
+	e.mu.Unlock()
+	resp := v2.DiscoveryResponse{
+		VersionInfo: strconv.Itoa(version),
+		Resources:   make([]types.Any, 0, len(values)+1),
+	}
+	for _, v := range append(values, sources) {
+		any, err := types.MarshalAny(v)
+		if err != nil {
+			e.WithError(err).Error("failed to export state")
+			return nil
+		}
+		resp.Resources = append(resp.Resources, *any)
+	}
+	buf, err := proto.Marshal(&resp)
+	if err != nil {
+		e.WithError(err).Error("failed to export state")
+		return nil
+	}
+	return buf
+}
+
+// ImportState restores the ClusterLoadAssignments, and the version, recorded
+// by ExportState. The restored ClusterLoadAssignments are served immediately
+// and are replaced as informer events are received. Those which no Endpoints
+// object produces are withdrawn by Synced.
+func (e *EndpointsTranslator) ImportState(buf []byte) error {
+	var resp v2.DiscoveryResponse
+	if err := proto.Unmarshal(buf, &resp); err != nil {
+		return err
+	}
+	version, err := strconv.Atoi(resp.VersionInfo)
+	if err != nil {
+		return err
+	}
+	clas := make([]*v2.ClusterLoadAssignment, 0, len(resp.Resources))
+	var sources types.Struct
+	for i := range resp.Resources {
+		if types.Is(&resp.Resources[i], &sources) {
+			if err := types.UnmarshalAny(&resp.Resources[i], &sources); err != nil {
+				return err
+			}
+			continue
+		}
+		var cla v2.ClusterLoadAssignment
+		if err := types.UnmarshalAny(&resp.Resources[i], &cla); err != nil {
+			return err
+		}
+		clas = append(clas, &cla)
+	}
+
+	for _, cla := range clas {
+		e.add(cla, StateImported)
+	}
+	e.mu.Lock()
+	if e.imported == nil {
+		e.imported = make(map[string]bool)
+	}
+	if e.sources == nil {
+		e.sources = make(map[string]string)
+	}
+	for _, cla := range clas {
+		e.imported[cla.ClusterName] = true
+		if v, ok := sources.Fields[cla.ClusterName]; ok {
+			if _, ok := e.sources[cla.ClusterName]; !ok {
+				e.sources[cla.ClusterName] = v.GetStringValue()
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	// never move the version backwards, as that would prevent
+	// waiters from observing the restored state.
+	e.Cond.mu.Lock()
+	if version > e.Cond.last {
+		e.Cond.last = version
+	}
+	e.Cond.mu.Unlock()
+	e.Notify()
+	return nil
+}
+
+// sortLocalities orders llbs by priority, then by region, zone, and
+// subzone, so the same Endpoints always produce the same
+// ClusterLoadAssignment regardless of the order of their subsets.
+// Groups without a locality, as LocalityPerSubset produces, are
+// ordered by the address of their first endpoint.
+func sortLocalities(llbs []endpoint.LocalityLbEndpoints) {
+	key := func(l endpoint.LocalityLbEndpoints) string {
+		first := ""
+		if len(l.LbEndpoints) > 0 {
+			first = l.LbEndpoints[0].Endpoint.Address.GetSocketAddress().GetAddress()
+		}
+		return strings.Join([]string{l.Locality.GetRegion(), l.Locality.GetZone(), l.Locality.GetSubZone(), first}, "/")
+	}
+	sort.SliceStable(llbs, func(i, j int) bool {
+		if llbs[i].Priority != llbs[j].Priority {
+			return llbs[i].Priority < llbs[j].Priority
+		}
+		return key(llbs[i]) < key(llbs[j])
+	})
+}
+
+// sortByAddress orders lbs by address, then by port.
+func sortByAddress(lbs []endpoint.LbEndpoint) {
+	sort.SliceStable(lbs, func(i, j int) bool {
+		si := lbs[i].Endpoint.Address.GetSocketAddress()
+		sj := lbs[j].Endpoint.Address.GetSocketAddress()
+		if si.GetAddress() != sj.GetAddress() {
+			return si.GetAddress() < sj.GetAddress()
+		}
+		return si.GetPortValue() < sj.GetPortValue()
+	})
+}
+
+// sortByHash orders lbs by the FNV-1a hash of their address and port,
+// falling back to the address itself in the unlikely event of a tie.
+func sortByHash(lbs []endpoint.LbEndpoint) {
+	keys := make(map[string]uint64, len(lbs))
+	key := func(lb endpoint.LbEndpoint) string {
+		sa := lb.Endpoint.Address.GetSocketAddress()
+		return net.JoinHostPort(sa.Address, strconv.Itoa(int(sa.GetPortValue())))
+	}
+	for _, lb := range lbs {
+		k := key(lb)
+		h := fnv.New64a()
+		h.Write([]byte(k))
+		keys[k] = h.Sum64()
+	}
+	sort.SliceStable(lbs, func(i, j int) bool {
+		ki, kj := key(lbs[i]), key(lbs[j])
+		if keys[ki] == keys[kj] {
+			return ki < kj
+		}
+		return keys[ki] < keys[kj]
+	})
+}
+
+// malformedAddress logs, and records, that a could not be translated.
+func (e *EndpointsTranslator) malformedAddress(ep *v1.Endpoints, a v1.EndpointAddress) {
+	e.WithFields(logrus.Fields{
+		"namespace": ep.Namespace,
+		"name":      ep.Name,
+		"hostname":  a.Hostname,
+	}).Warn("skipping endpoint address with empty IP")
+	if e.Metrics != nil {
+		e.Metrics.IncMalformedEndpoints()
+	}
+}
+
+// pod returns the pod referenced by a, or nil if Pods is not set or
+// the pod is not known.
+func (e *EndpointsTranslator) pod(a v1.EndpointAddress) *v1.Pod {
+	if e.Pods == nil || a.TargetRef == nil || a.TargetRef.Kind != "Pod" {
+		return nil
+	}
+	pod, err := e.Pods.Pods(a.TargetRef.Namespace).Get(a.TargetRef.Name)
+	if err != nil {
+		// the pod may not have reached the informer's cache yet.
+		return nil
+	}
+	return pod
+}
+
+// locality returns the Locality of the node behind a, taken from the
+// node's region and zone labels, or nil if it cannot be determined.
+func (e *EndpointsTranslator) locality(a v1.EndpointAddress) *core.Locality {
+	if e.Nodes == nil || a.NodeName == nil {
+		return nil
+	}
+	node, err := e.Nodes.Get(*a.NodeName)
+	if err != nil {
+		// the node may not have reached the informer's cache yet.
+		return nil
+	}
+	region := nodeLabel(node, labelTopologyRegion, labelFailureDomainRegion)
+	zone := nodeLabel(node, labelTopologyZone, labelFailureDomainZone)
+	if region == "" && zone == "" {
+		return nil
+	}
+	return &core.Locality{
+		Region: region,
+		Zone:   zone,
+	}
+}
+
+// nodeLabel returns the value of the first of keys present on node.
+func nodeLabel(node *v1.Node, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := node.Labels[k]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// localityGroup returns the LocalityLbEndpoints group of cla for loc,
+// adding one if cla has none.
+func localityGroup(cla *v2.ClusterLoadAssignment, loc *core.Locality) *endpoint.LocalityLbEndpoints {
+	for i := range cla.Endpoints {
+		l := cla.Endpoints[i].Locality
+		if (l == nil) == (loc == nil) && l.GetRegion() == loc.GetRegion() && l.GetZone() == loc.GetZone() {
+			return &cla.Endpoints[i]
+		}
+	}
+	if len(cla.Endpoints) == 1 && cla.Endpoints[0].Locality == nil && len(cla.Endpoints[0].LbEndpoints) == 0 {
+		// claim the initial, empty, group.
+		cla.Endpoints[0].Locality = loc
+		return &cla.Endpoints[0]
+	}
+	cla.Endpoints = append(cla.Endpoints, endpoint.LocalityLbEndpoints{Locality: loc})
+	return &cla.Endpoints[len(cla.Endpoints)-1]
+}
+
+// upstreamSNI returns the value of the contour.heptio.com/upstream-sni
+// annotation on pod, if present, otherwise on ep.
+func upstreamSNI(ep *v1.Endpoints, pod *v1.Pod) string {
+	if pod != nil {
+		if sni, ok := pod.Annotations[annotationUpstreamSNI]; ok {
+			return sni
+		}
+	}
+	return ep.Annotations[annotationUpstreamSNI]
+}
+
+// setMetadata sets key to value in lb's metadata under the filter
+// namespace.
+func setMetadata(lb *endpoint.LbEndpoint, filter, key, value string) {
+	if lb.Metadata == nil {
+		lb.Metadata = &core.Metadata{
+			FilterMetadata: make(map[string]*types.Struct),
+		}
+	}
+	st, ok := lb.Metadata.FilterMetadata[filter]
+	if !ok {
+		st = &types.Struct{
+			Fields: make(map[string]*types.Value),
+		}
+		lb.Metadata.FilterMetadata[filter] = st
+	}
+	st.Fields[key] = &types.Value{Kind: &types.Value_StringValue{StringValue: value}}
+}
+
+// clusterPort returns the port name by which endpoints on the named
+// port are grouped into a ClusterLoadAssignment.
+func (e *EndpointsTranslator) clusterPort(name string) string {
+	if e.ConsolidatePorts {
+		return ""
+	}
+	return name
+}
+
+// endpointsOptions holds the translator options which may be
+// overridden for a single Endpoints object by annotation.
+type endpointsOptions struct {
+	healthStatus     core.HealthStatus
+	failoverPriority uint32
+	healthCheckPort  uint32 // zero if not set
+	report           bool   // log and record malformed addresses
+}
+
+// options returns the options in effect for ep. An annotation on ep
+// takes precedence over the corresponding EndpointsTranslator field;
+// an invalid annotation is ignored, and if report is true, logged.
+func (e *EndpointsTranslator) options(ep *v1.Endpoints, report bool) endpointsOptions {
+	opts := endpointsOptions{
+		healthStatus:     e.DefaultHealthStatus,
+		failoverPriority: e.FailoverPriority,
+		report:           report,
+	}
+	if e.IncludeNotReadyEndpoints && opts.healthStatus == core.HealthStatus_UNKNOWN {
+		opts.healthStatus = core.HealthStatus_HEALTHY
+	}
+	if opts.failoverPriority == 0 {
+		opts.failoverPriority = 1
+	}
+
+	if v, ok := ep.Annotations[annotationEndpointHealthStatus]; ok {
+		if hs, ok := core.HealthStatus_value[strings.ToUpper(v)]; ok {
+			opts.healthStatus = core.HealthStatus(hs)
+		} else if report {
+			e.invalidAnnotation(ep, annotationEndpointHealthStatus, v)
+		}
+	}
+	if v, ok := ep.Annotations[annotationHealthCheckPort]; ok {
+		if p, err := strconv.ParseUint(v, 10, 16); err == nil && p > 0 {
+			opts.healthCheckPort = uint32(p)
+		} else if report {
+			e.invalidAnnotation(ep, annotationHealthCheckPort, v)
+		}
+	}
+	if v, ok := ep.Annotations[annotationFailoverPriority]; ok {
+		if p, err := strconv.ParseUint(v, 10, 32); err == nil && p > 0 {
+			opts.failoverPriority = uint32(p)
+		} else if report {
+			e.invalidAnnotation(ep, annotationFailoverPriority, v)
+		}
+	}
+	return opts
+}
+
+func (e *EndpointsTranslator) invalidAnnotation(ep *v1.Endpoints, annotation, value string) {
+	e.WithFields(logrus.Fields{
+		"namespace":  ep.Namespace,
+		"name":       ep.Name,
+		"annotation": annotation,
+		"value":      value,
+	}).Warn("ignoring invalid annotation")
+}
+
+// failoverAddresses returns the set of addresses listed in ep's
+// contour.heptio.com/failover-addresses annotation.
+func failoverAddresses(ep *v1.Endpoints) map[string]bool {
+	addrs := make(map[string]bool)
+	for _, a := range strings.Split(ep.Annotations[annotationFailoverAddresses], ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs[a] = true
+		}
+	}
+	return addrs
+}
+
+// clock returns e's Clock, or the wall clock if not configured.
+func (e *EndpointsTranslator) clock() Clock {
+	if e.Clock != nil {
+		return e.Clock
+	}
+	return realClock{}
+}
+
+// add adds cla to the cache, unless publication of its cluster is held back.
+func (e *EndpointsTranslator) add(cla *v2.ClusterLoadAssignment, reason ChangeReason) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.set(cla.ClusterName, cla, reason)
+}
+
+// remove removes the named cluster from the cache, unless publication of
+// the cluster is held back.
+func (e *EndpointsTranslator) remove(name string, reason ChangeReason) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.set(name, nil, reason)
+}
+
+// set publishes cla under name, or removes name if cla is nil, for the
+// given reason. If the informer is disconnected, or the cluster is paused,
+// the change is recorded rather than published, and the reason reported
+// when it is eventually published is that of the flush.
+// Callers must hold e.mu.
+func (e *EndpointsTranslator) set(name string, cla *v2.ClusterLoadAssignment, reason ChangeReason) {
+	if reason != StateImported {
+		delete(e.imported, name)
+	}
+	if e.disconnected {
+		if e.held == nil {
+			e.held = make(map[string]*v2.ClusterLoadAssignment)
+		}
+		e.held[name] = cla
+		return
+	}
+	if p, ok := e.paused[name]; ok {
+		p.cla, p.changed = cla, true
+		return
+	}
+	_, exists := e.get(name)
+	switch {
+	case cla != nil:
+		e.Add(cla)
+		if e.updated == nil {
+			e.updated = make(map[string]time.Time)
+		}
+		e.updated[name] = e.clock().Now()
+		if e.Metrics != nil {
+			n := 0
+			for _, lle := range cla.Endpoints {
+				n += len(lle.LbEndpoints)
+			}
+			e.Metrics.SetEDSEndpoints(name, n)
+		}
+		change := ClusterChange{Type: ClusterUpdated, Name: name, Reason: reason, ClusterLoadAssignment: cla}
+		if !exists {
+			change.Type = ClusterAdded
+		}
+		e.publish(change)
+		e.evict(name)
+	case exists:
+		e.Remove(name)
+		delete(e.updated, name)
+		delete(e.sources, name)
+		delete(e.collided, name)
+		if e.Metrics != nil {
+			e.Metrics.DeleteEDSEndpoints(name)
+		}
+		e.publish(ClusterChange{Type: ClusterRemoved, Name: name, Reason: reason})
+	}
+	if e.Metrics != nil {
+		e.Metrics.SetEDSClusterLoadAssignments(len(e.updated))
+	}
+}
+
+// evict removes the least recently updated clusters until no more
+// than MaxClusters remain. The cluster named keep, which has just been
+// inserted, is never a candidate for eviction even if its timestamp
+// ties with another cluster's. Paused clusters are not evicted, as
+// their held change would be published by ResumeCluster. Callers must
+// hold e.mu.
+func (e *EndpointsTranslator) evict(keep string) {
+	if e.MaxClusters <= 0 || len(e.updated) <= e.MaxClusters {
+		return
+	}
+	names := make([]string, 0, len(e.updated))
+	for name := range e.updated {
+		if _, paused := e.paused[name]; name != keep && !paused {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ti, tj := e.updated[names[i]], e.updated[names[j]]
+		if ti.Equal(tj) {
+			return names[i] < names[j]
+		}
+		return ti.Before(tj)
+	})
+	n := len(e.updated) - e.MaxClusters
+	if n > len(names) {
+		n = len(names)
+	}
+	for _, name := range names[:n] {
+		e.WithField("cluster", name).Warn("cluster limit exceeded, evicting least recently updated cluster")
+		if e.Metrics != nil {
+			e.Metrics.IncEDSClusterEvictions()
+			e.Metrics.DeleteEDSEndpoints(name)
+		}
+		e.Remove(name)
+		delete(e.updated, name)
+		delete(e.sources, name)
+		delete(e.collided, name)
+		delete(e.imported, name)
+		e.forgetEmptied(name)
+		e.publish(ClusterChange{Type: ClusterRemoved, Name: name, Reason: ClusterEvicted})
 	}
 }
 
@@ -169,6 +1313,56 @@ func servicename(meta metav1.ObjectMeta, portname string) string {
 	return strings.Join(name, "/")
 }
 
+// clusterName strips e's StripClusterNamePrefix from name, applies e's
+// ClusterNamePolicy to the result, and returns the name under which it
+// should be published, and false if it should not be published at all.
+func (e *EndpointsTranslator) clusterName(name string) (string, bool) {
+	if e.StripClusterNamePrefix != "" {
+		name = strings.TrimPrefix(name, e.StripClusterNamePrefix)
+	}
+	if validClusterName(name) {
+		return name, true
+	}
+	switch e.ClusterNamePolicy {
+	case SanitizeInvalidClusterNames:
+		return strings.Map(func(r rune) rune {
+			if validClusterNameRune(r) {
+				return r
+			}
+			return '_'
+		}, name), true
+	default:
+		return name, false
+	}
+}
+
+// validClusterName returns true if name is non empty and consists only of
+// ASCII letters, digits, and the characters '-', '_', '.', '/', and ':'.
+// This is the set of characters Kubernetes object and port names, and the
+// separators Contour places between them, are drawn from.
+func validClusterName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !validClusterNameRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func validClusterNameRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r == '-', r == '_', r == '.', r == '/', r == ':':
+		return true
+	default:
+		return false
+	}
+}
+
 func clusterloadassignment(name string, lbendpoints ...endpoint.LbEndpoint) *v2.ClusterLoadAssignment {
 	return &v2.ClusterLoadAssignment{
 		ClusterName: name,
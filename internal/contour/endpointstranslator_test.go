@@ -14,13 +14,24 @@
 package contour
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	"github.com/gogo/protobuf/proto"
+	"github.com/heptio/contour/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listers "k8s.io/client-go/listers/core/v1"
+	_cache "k8s.io/client-go/tools/cache"
 )
 
 func TestEndpointsTranslatorAddEndpoints(t *testing.T) {
@@ -66,7 +77,6 @@ func TestEndpointsTranslatorAddEndpoints(t *testing.T) {
 			}
 			et.OnAdd(tc.ep)
 			got := contents(et)
-			sort.Stable(clusterLoadAssignmentsByName(got))
 			if !reflect.DeepEqual(tc.want, got) {
 				t.Fatalf("got: %v, want: %v", got, tc.want)
 			}
@@ -155,7 +165,6 @@ func TestEndpointsTranslatorRemoveEndpoints(t *testing.T) {
 			tc.setup(et)
 			et.OnDelete(tc.ep)
 			got := contents(et)
-			sort.Stable(clusterLoadAssignmentsByName(got))
 			if !reflect.DeepEqual(tc.want, got) {
 				t.Fatalf("\nwant: %v\n got: %v", tc.want, got)
 			}
@@ -166,16 +175,12 @@ func TestEndpointsTranslatorRemoveEndpoints(t *testing.T) {
 func TestEndpointsTranslatorRecomputeClusterLoadAssignment(t *testing.T) {
 	tests := map[string]struct {
 		oldep, newep *v1.Endpoints
-		want         []proto.Message
 	}{
 		"simple": {
 			newep: endpoints("default", "simple", v1.EndpointSubset{
 				Addresses: addresses("192.168.183.24"),
 				Ports:     ports(8080),
 			}),
-			want: []proto.Message{
-				clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
-			},
 		},
 		"multiple addresses": {
 			newep: endpoints("default", "httpbin-org", v1.EndpointSubset{
@@ -187,14 +192,6 @@ func TestEndpointsTranslatorRecomputeClusterLoadAssignment(t *testing.T) {
 				),
 				Ports: ports(80),
 			}),
-			want: []proto.Message{
-				clusterloadassignment("default/httpbin-org",
-					lbendpoint("23.23.247.89", 80),
-					lbendpoint("50.17.192.147", 80),
-					lbendpoint("50.17.206.192", 80),
-					lbendpoint("50.19.99.160", 80),
-				),
-			},
 		},
 		"named container port": {
 			newep: endpoints("default", "secure", v1.EndpointSubset{
@@ -204,34 +201,55 @@ func TestEndpointsTranslatorRecomputeClusterLoadAssignment(t *testing.T) {
 					Port: 8443,
 				}},
 			}),
-			want: []proto.Message{
-				clusterloadassignment("default/secure/https", lbendpoint("192.168.183.24", 8443)),
-			},
+		},
+		"named container port resolving to different ports": {
+			// the same named port may resolve to a different numeric port
+			// on each pod, see TestAddEndpointComplicated. Endpoints are
+			// grouped by port name and keep their own numeric port.
+			newep: endpoints("default", "kuard", v1.EndpointSubset{
+				Addresses: addresses("10.48.1.77"),
+				Ports: []v1.EndpointPort{{
+					Name: "foo",
+					Port: 9999,
+				}},
+			}, v1.EndpointSubset{
+				Addresses: addresses("10.48.1.78"),
+				Ports: []v1.EndpointPort{{
+					Name: "foo",
+					Port: 8080,
+				}},
+			}, v1.EndpointSubset{
+				Addresses: addresses("10.48.1.77", "10.48.1.78"),
+				Ports: []v1.EndpointPort{{
+					Name: "admin",
+					Port: 9000,
+				}},
+			}),
 		},
 		"remove existing": {
 			oldep: endpoints("default", "simple", v1.EndpointSubset{
 				Addresses: addresses("192.168.183.24"),
 				Ports:     ports(8080),
 			}),
-			want: []proto.Message{},
 		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			var et EndpointsTranslator
-			et.recomputeClusterLoadAssignment(tc.oldep, tc.newep)
-			got := contents(&et)
-			sort.Stable(clusterLoadAssignmentsByName(got))
-			if !reflect.DeepEqual(tc.want, got) {
-				t.Fatalf("expected:\n%v\ngot:\n%v", tc.want, got)
+			et := &EndpointsTranslator{
+				FieldLogger: testLogger(t),
 			}
+			et.recomputeClusterLoadAssignment(tc.oldep, tc.newep)
+			got := contents(et)
+			golden(t, got)
 		})
 	}
 }
 
 // See #602
 func TestEndpointsTranslatorScaleToZeroEndpoints(t *testing.T) {
-	var et EndpointsTranslator
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
 	e1 := endpoints("default", "simple", v1.EndpointSubset{
 		Addresses: addresses("192.168.183.24"),
 		Ports:     ports(8080),
@@ -242,7 +260,7 @@ func TestEndpointsTranslatorScaleToZeroEndpoints(t *testing.T) {
 	want := []proto.Message{
 		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
 	}
-	got := contents(&et)
+	got := contents(et)
 	if !reflect.DeepEqual(want, got) {
 		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
 	}
@@ -253,16 +271,1806 @@ func TestEndpointsTranslatorScaleToZeroEndpoints(t *testing.T) {
 
 	// Assert endpoints are removed
 	want = []proto.Message{}
-	got = contents(&et)
+	got = contents(et)
 	if !reflect.DeepEqual(want, got) {
 		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
 	}
 }
 
-type clusterLoadAssignmentsByName []proto.Message
+func TestEndpointsTranslatorCLAMutator(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+		CLAMutator: func(cla *v2.ClusterLoadAssignment) {
+			cla.Policy = &v2.ClusterLoadAssignment_Policy{
+				DropOverloads: []*v2.ClusterLoadAssignment_Policy_DropOverload{{
+					Category: "throttle",
+				}},
+			}
+		},
+	}
+	et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	}))
 
-func (c clusterLoadAssignmentsByName) Len() int      { return len(c) }
-func (c clusterLoadAssignmentsByName) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
-func (c clusterLoadAssignmentsByName) Less(i, j int) bool {
-	return c[i].(*v2.ClusterLoadAssignment).ClusterName < c[j].(*v2.ClusterLoadAssignment).ClusterName
+	cla := clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080))
+	cla.Policy = &v2.ClusterLoadAssignment_Policy{
+		DropOverloads: []*v2.ClusterLoadAssignment_Policy_DropOverload{{
+			Category: "throttle",
+		}},
+	}
+	want := []proto.Message{cla}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEndpointsTranslatorClusterNamePolicy(t *testing.T) {
+	tests := map[string]struct {
+		policy ClusterNamePolicy
+		want   []proto.Message
+	}{
+		"reject": {
+			policy: RejectInvalidClusterNames,
+			want:   []proto.Message{},
+		},
+		"sanitize": {
+			policy: SanitizeInvalidClusterNames,
+			want: []proto.Message{
+				clusterloadassignment("my_namespace/simple", lbendpoint("192.168.183.24", 8080)),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &EndpointsTranslator{
+				FieldLogger:       testLogger(t),
+				ClusterNamePolicy: tc.policy,
+			}
+			e1 := endpoints("my namespace", "simple", v1.EndpointSubset{
+				Addresses: addresses("192.168.183.24"),
+				Ports:     ports(8080),
+			})
+			et.OnAdd(e1)
+			got := contents(et)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected:\n%v\ngot:\n%v\n", tc.want, got)
+			}
+
+			// removing the endpoints must remove the published name.
+			et.OnDelete(e1)
+			got = contents(et)
+			if len(got) != 0 {
+				t.Fatalf("expected no cluster load assignments, got: %v", got)
+			}
+		})
+	}
+}
+
+func TestEndpointsTranslatorPauseCluster(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	s1 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	s2 := endpoints("default", "other", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.25"),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(s1)
+	et.OnAdd(s2)
+
+	et.PauseCluster("default/simple")
+
+	s1a := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.26"),
+		Ports:     ports(8080),
+	})
+	s2a := endpoints("default", "other", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.25", "192.168.183.27"),
+		Ports:     ports(8080),
+	})
+	et.OnUpdate(s1, s1a)
+	et.OnUpdate(s2, s2a)
+
+	// the paused cluster is unchanged, the other has been updated.
+	want := []proto.Message{
+		clusterloadassignment("default/other", lbendpoint("192.168.183.25", 8080), lbendpoint("192.168.183.27", 8080)),
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+
+	et.ResumeCluster("default/simple")
+
+	want = []proto.Message{
+		clusterloadassignment("default/other", lbendpoint("192.168.183.25", 8080), lbendpoint("192.168.183.27", 8080)),
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080), lbendpoint("192.168.183.26", 8080)),
+	}
+	got = contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEndpointsTranslatorLocalityPerSubset(t *testing.T) {
+	e1 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	}, v1.EndpointSubset{
+		Addresses: addresses("192.168.183.25", "192.168.183.26"),
+		Ports:     ports(8080),
+	})
+
+	tests := map[string]struct {
+		localityPerSubset bool
+		want              []proto.Message
+	}{
+		"flattened": {
+			localityPerSubset: false,
+			want: []proto.Message{
+				clusterloadassignment("default/simple",
+					lbendpoint("192.168.183.24", 8080),
+					lbendpoint("192.168.183.25", 8080),
+					lbendpoint("192.168.183.26", 8080),
+				),
+			},
+		},
+		"locality per subset": {
+			localityPerSubset: true,
+			want: []proto.Message{
+				&v2.ClusterLoadAssignment{
+					ClusterName: "default/simple",
+					Endpoints: []endpoint.LocalityLbEndpoints{{
+						LbEndpoints: []endpoint.LbEndpoint{
+							lbendpoint("192.168.183.24", 8080),
+						},
+					}, {
+						LbEndpoints: []endpoint.LbEndpoint{
+							lbendpoint("192.168.183.25", 8080),
+							lbendpoint("192.168.183.26", 8080),
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &EndpointsTranslator{
+				FieldLogger:       testLogger(t),
+				LocalityPerSubset: tc.localityPerSubset,
+			}
+			et.OnAdd(e1)
+			got := contents(et)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected:\n%v\ngot:\n%v\n", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEndpointsTranslatorDefaultHealthStatus(t *testing.T) {
+	tests := map[string]core.HealthStatus{
+		"unknown":  core.HealthStatus_UNKNOWN,
+		"healthy":  core.HealthStatus_HEALTHY,
+		"draining": core.HealthStatus_DRAINING,
+	}
+
+	for name, status := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &EndpointsTranslator{
+				FieldLogger:         testLogger(t),
+				DefaultHealthStatus: status,
+			}
+			et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+				Addresses: addresses("192.168.183.24", "192.168.183.25"),
+				Ports:     ports(8080),
+			}))
+			for _, m := range contents(et) {
+				for _, lle := range m.(*v2.ClusterLoadAssignment).Endpoints {
+					for _, lb := range lle.LbEndpoints {
+						if lb.HealthStatus != status {
+							t.Errorf("%v: expected health status %v, got %v", lb.Endpoint.Address, status, lb.HealthStatus)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointsTranslatorAnnotationOverrides(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger:         testLogger(t),
+		DefaultHealthStatus: core.HealthStatus_HEALTHY,
+	}
+	annotated := func(name string, annotations map[string]string) *v1.Endpoints {
+		ep := endpoints("default", name, v1.EndpointSubset{
+			Addresses: addresses("192.168.183.24"),
+			Ports:     ports(8080),
+		})
+		ep.Annotations = annotations
+		return ep
+	}
+	et.OnAdd(annotated("draining", map[string]string{
+		"contour.heptio.com/endpoint-health-status": "draining",
+	}))
+	et.OnAdd(annotated("invalid", map[string]string{
+		"contour.heptio.com/endpoint-health-status": "sleepy",
+	}))
+	et.OnAdd(annotated("default", nil))
+
+	want := map[string]core.HealthStatus{
+		"default/draining": core.HealthStatus_DRAINING,
+		"default/invalid":  core.HealthStatus_HEALTHY,
+		"default/default":  core.HealthStatus_HEALTHY,
+	}
+	got := make(map[string]core.HealthStatus)
+	for _, m := range contents(et) {
+		cla := m.(*v2.ClusterLoadAssignment)
+		got[cla.ClusterName] = cla.Endpoints[0].LbEndpoints[0].HealthStatus
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorHealthCheckPort(t *testing.T) {
+	tests := map[string]struct {
+		annotations map[string]string
+		want        *endpoint.Endpoint_HealthCheckConfig
+	}{
+		"not annotated": {
+			want: nil,
+		},
+		"annotated": {
+			annotations: map[string]string{
+				"contour.heptio.com/health-check-port": "9901",
+			},
+			want: &endpoint.Endpoint_HealthCheckConfig{
+				PortValue: 9901,
+			},
+		},
+		"out of range": {
+			annotations: map[string]string{
+				"contour.heptio.com/health-check-port": "65536",
+			},
+			want: nil,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &EndpointsTranslator{
+				FieldLogger: testLogger(t),
+			}
+			ep := endpoints("default", "simple", v1.EndpointSubset{
+				Addresses: addresses("192.168.183.24"),
+				Ports:     ports(8080),
+			})
+			ep.Annotations = tc.annotations
+			et.OnAdd(ep)
+			got := contents(et)[0].(*v2.ClusterLoadAssignment).Endpoints[0].LbEndpoints[0].Endpoint.HealthCheckConfig
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEndpointsTranslatorFailoverPriorityAnnotation(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger:      testLogger(t),
+		FailoverPriority: 1,
+		NotReadyPriority: 2,
+	}
+	ep := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses:         addresses("192.168.183.24", "10.0.0.1"),
+		NotReadyAddresses: addresses("192.168.183.25"),
+		Ports:             ports(8080),
+	})
+	ep.Annotations = map[string]string{
+		"contour.heptio.com/failover-addresses": "10.0.0.1",
+		"contour.heptio.com/failover-priority":  "3",
+	}
+	et.OnAdd(ep)
+
+	// the annotation places the failover endpoints below the not
+	// ready endpoints.
+	want := []proto.Message{
+		&v2.ClusterLoadAssignment{
+			ClusterName: "default/simple",
+			Endpoints: []endpoint.LocalityLbEndpoints{{
+				LbEndpoints: []endpoint.LbEndpoint{
+					lbendpoint("192.168.183.24", 8080),
+				},
+			}, {
+				LbEndpoints: []endpoint.LbEndpoint{
+					lbendpoint("192.168.183.25", 8080),
+				},
+				Priority: 1,
+			}, {
+				LbEndpoints: []endpoint.LbEndpoint{
+					lbendpoint("10.0.0.1", 8080),
+				},
+				Priority: 2,
+			}},
+		},
+	}
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorContiguousPriorities(t *testing.T) {
+	subset := v1.EndpointSubset{
+		Addresses:         addresses("192.168.183.24", "10.0.0.1"),
+		NotReadyAddresses: addresses("192.168.183.25"),
+		Ports:             ports(8080),
+	}
+
+	tests := map[string]struct {
+		failover, notReady uint32
+		want               []uint32
+	}{
+		"empty levels above failover": {
+			failover: 3,
+			want:     []uint32{0, 1},
+		},
+		"empty middle level": {
+			failover: 3,
+			notReady: 1,
+			want:     []uint32{0, 1, 2},
+		},
+		"shared level": {
+			failover: 2,
+			notReady: 2,
+			want:     []uint32{0, 1},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &EndpointsTranslator{
+				FieldLogger:      testLogger(t),
+				FailoverPriority: tc.failover,
+				NotReadyPriority: tc.notReady,
+			}
+			ep := endpoints("default", "simple", subset)
+			ep.Annotations = map[string]string{
+				"contour.heptio.com/failover-addresses": "10.0.0.1",
+			}
+			et.OnAdd(ep)
+
+			got := contents(et)
+			if len(got) != 1 {
+				t.Fatalf("expected 1 cluster, got %v", got)
+			}
+			var priorities []uint32
+			for _, lle := range got[0].(*v2.ClusterLoadAssignment).Endpoints {
+				priorities = append(priorities, lle.Priority)
+			}
+			if !reflect.DeepEqual(tc.want, priorities) {
+				t.Fatalf("expected priorities %v, got %v", tc.want, priorities)
+			}
+		})
+	}
+}
+
+func TestEndpointsTranslatorFailoverAddresses(t *testing.T) {
+	failover := func(addrs string, subsets ...v1.EndpointSubset) *v1.Endpoints {
+		ep := endpoints("default", "simple", subsets...)
+		ep.Annotations = map[string]string{
+			"contour.heptio.com/failover-addresses": addrs,
+		}
+		return ep
+	}
+
+	tests := map[string]struct {
+		ep   *v1.Endpoints
+		want []proto.Message
+	}{
+		"primaries and failover": {
+			ep: failover("10.0.0.1", v1.EndpointSubset{
+				Addresses: addresses("192.168.183.24", "10.0.0.1", "192.168.183.25"),
+				Ports:     ports(8080),
+			}),
+			want: []proto.Message{
+				&v2.ClusterLoadAssignment{
+					ClusterName: "default/simple",
+					Endpoints: []endpoint.LocalityLbEndpoints{{
+						LbEndpoints: []endpoint.LbEndpoint{
+							lbendpoint("192.168.183.24", 8080),
+							lbendpoint("192.168.183.25", 8080),
+						},
+					}, {
+						LbEndpoints: []endpoint.LbEndpoint{
+							lbendpoint("10.0.0.1", 8080),
+						},
+						Priority: 1,
+					}},
+				},
+			},
+		},
+		"no primaries": {
+			ep: failover("10.0.0.1, 10.0.0.2", v1.EndpointSubset{
+				Addresses: addresses("10.0.0.1", "10.0.0.2"),
+				Ports:     ports(8080),
+			}),
+			want: []proto.Message{
+				&v2.ClusterLoadAssignment{
+					ClusterName: "default/simple",
+					Endpoints: []endpoint.LocalityLbEndpoints{{
+						// priority 0 is empty, so Envoy fails over to priority 1.
+					}, {
+						LbEndpoints: []endpoint.LbEndpoint{
+							lbendpoint("10.0.0.1", 8080),
+							lbendpoint("10.0.0.2", 8080),
+						},
+						Priority: 1,
+					}},
+				},
+			},
+		},
+		"failover address not present": {
+			ep: failover("10.0.0.9", v1.EndpointSubset{
+				Addresses: addresses("192.168.183.24"),
+				Ports:     ports(8080),
+			}),
+			want: []proto.Message{
+				clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &EndpointsTranslator{
+				FieldLogger: testLogger(t),
+			}
+			et.OnAdd(tc.ep)
+			got := contents(et)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected:\n%v\ngot:\n%v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEndpointsTranslatorTerminatingPods(t *testing.T) {
+	pods := _cache.NewIndexer(_cache.MetaNamespaceKeyFunc, _cache.Indexers{})
+	now := metav1.Now()
+	pods.Add(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "running",
+			Namespace: "default",
+		},
+	})
+	pods.Add(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "terminating",
+			Namespace:         "default",
+			DeletionTimestamp: &now,
+		},
+	})
+
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+		Pods:        listers.NewPodLister(pods),
+	}
+	podref := func(ip, pod string) v1.EndpointAddress {
+		return v1.EndpointAddress{
+			IP: ip,
+			TargetRef: &v1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: "default",
+				Name:      pod,
+			},
+		}
+	}
+	et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: []v1.EndpointAddress{
+			podref("192.168.183.24", "running"),
+			podref("192.168.183.25", "terminating"),
+			podref("192.168.183.26", "unknown"),
+		},
+		Ports: ports(8080),
+	}))
+
+	draining := lbendpoint("192.168.183.25", 8080)
+	draining.HealthStatus = core.HealthStatus_DRAINING
+	want := []proto.Message{
+		clusterloadassignment("default/simple",
+			lbendpoint("192.168.183.24", 8080),
+			draining,
+			lbendpoint("192.168.183.26", 8080),
+		),
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorZoneAwareLocalities(t *testing.T) {
+	nodes := _cache.NewIndexer(_cache.MetaNamespaceKeyFunc, _cache.Indexers{})
+	nodes.Add(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-a",
+			Labels: map[string]string{
+				"topology.kubernetes.io/region": "us-east-1",
+				"topology.kubernetes.io/zone":   "us-east-1a",
+			},
+		},
+	})
+	nodes.Add(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-b",
+			Labels: map[string]string{
+				"failure-domain.beta.kubernetes.io/region": "us-east-1",
+				"failure-domain.beta.kubernetes.io/zone":   "us-east-1b",
+			},
+		},
+	})
+
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+		Nodes:       listers.NewNodeLister(nodes),
+	}
+	onnode := func(ip, node string) v1.EndpointAddress {
+		return v1.EndpointAddress{
+			IP:       ip,
+			NodeName: &node,
+		}
+	}
+	et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: []v1.EndpointAddress{
+			onnode("192.168.183.24", "node-a"),
+			onnode("192.168.183.25", "node-b"),
+			onnode("192.168.183.26", "node-a"),
+			onnode("192.168.183.27", "unknown"),
+		},
+		Ports: ports(8080),
+	}))
+
+	want := []proto.Message{
+		&v2.ClusterLoadAssignment{
+			ClusterName: "default/simple",
+			Endpoints: []endpoint.LocalityLbEndpoints{{
+				LbEndpoints: []endpoint.LbEndpoint{
+					lbendpoint("192.168.183.27", 8080),
+				},
+			}, {
+				Locality: &core.Locality{
+					Region: "us-east-1",
+					Zone:   "us-east-1a",
+				},
+				LbEndpoints: []endpoint.LbEndpoint{
+					lbendpoint("192.168.183.24", 8080),
+					lbendpoint("192.168.183.26", 8080),
+				},
+			}, {
+				Locality: &core.Locality{
+					Region: "us-east-1",
+					Zone:   "us-east-1b",
+				},
+				LbEndpoints: []endpoint.LbEndpoint{
+					lbendpoint("192.168.183.25", 8080),
+				},
+			}},
+		},
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorUpstreamSNI(t *testing.T) {
+	pods := _cache.NewIndexer(_cache.MetaNamespaceKeyFunc, _cache.Indexers{})
+	pods.Add(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "override",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"contour.heptio.com/upstream-sni": "pod.example.com",
+			},
+		},
+	})
+
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+		Pods:        listers.NewPodLister(pods),
+	}
+	ep := endpoints("default", "secure", v1.EndpointSubset{
+		Addresses: []v1.EndpointAddress{{
+			IP: "192.168.183.24",
+		}, {
+			IP: "192.168.183.25",
+			TargetRef: &v1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: "default",
+				Name:      "override",
+			},
+		}},
+		Ports: ports(8443),
+	})
+	ep.Annotations = map[string]string{
+		"contour.heptio.com/upstream-sni": "secure.example.com",
+	}
+	et.OnAdd(ep)
+	et.OnAdd(endpoints("default", "plain", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.26"),
+		Ports:     ports(8080),
+	}))
+
+	sni := func(lb endpoint.LbEndpoint) string {
+		if lb.Metadata == nil {
+			return ""
+		}
+		return lb.Metadata.FilterMetadata["envoy.transport_socket_match"].Fields["sni"].GetStringValue()
+	}
+	want := map[string]string{
+		"192.168.183.24": "secure.example.com",
+		"192.168.183.25": "pod.example.com",
+		"192.168.183.26": "",
+	}
+	got := make(map[string]string)
+	for _, m := range contents(et) {
+		for _, lle := range m.(*v2.ClusterLoadAssignment).Endpoints {
+			for _, lb := range lle.LbEndpoints {
+				got[lb.Endpoint.Address.GetSocketAddress().Address] = sni(lb)
+			}
+		}
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorMaxClusters(t *testing.T) {
+	clock := newFakeClock()
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+		Clock:       clock,
+		MaxClusters: 2,
+	}
+	add := func(name, ip string) {
+		et.OnAdd(endpoints("default", name, v1.EndpointSubset{
+			Addresses: addresses(ip),
+			Ports:     ports(8080),
+		}))
+		clock.Advance(time.Second)
+	}
+	add("oldest", "192.168.183.24")
+	add("middle", "192.168.183.25")
+
+	// refresh oldest, making middle the least recently updated.
+	et.OnUpdate(
+		endpoints("default", "oldest", v1.EndpointSubset{
+			Addresses: addresses("192.168.183.24"),
+			Ports:     ports(8080),
+		}),
+		endpoints("default", "oldest", v1.EndpointSubset{
+			Addresses: addresses("192.168.183.24", "192.168.183.26"),
+			Ports:     ports(8080),
+		}),
+	)
+	clock.Advance(time.Second)
+
+	changes, cancel := et.Subscribe()
+	defer cancel()
+	add("newest", "192.168.183.27")
+
+	want := []proto.Message{
+		clusterloadassignment("default/newest", lbendpoint("192.168.183.27", 8080)),
+		clusterloadassignment("default/oldest", lbendpoint("192.168.183.24", 8080), lbendpoint("192.168.183.26", 8080)),
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+
+	<-changes // newest added
+	if c := <-changes; c.Type != ClusterRemoved || c.Name != "default/middle" {
+		t.Fatalf("expected default/middle to be evicted, got %v %v", c.Type, c.Name)
+	}
+}
+
+func TestEndpointsTranslatorMaxClustersEqualTimestamps(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+		Clock:       newFakeClock(),
+		MaxClusters: 1,
+	}
+	et.OnAdd(endpoints("default", "b", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	}))
+	// the clock has not moved, a sorts before b but was just inserted.
+	et.OnAdd(endpoints("default", "a", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.25"),
+		Ports:     ports(8080),
+	}))
+
+	want := []proto.Message{
+		clusterloadassignment("default/a", lbendpoint("192.168.183.25", 8080)),
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorMaxClustersPausedAndEmptied(t *testing.T) {
+	clock := newFakeClock()
+	et := &EndpointsTranslator{
+		FieldLogger:                    testLogger(t),
+		Clock:                          clock,
+		MaxClusters:                    1,
+		EmitEmptyClusterLoadAssignment: true,
+	}
+	add := func(name, ip string) *v1.Endpoints {
+		ep := endpoints("default", name, v1.EndpointSubset{
+			Addresses: addresses(ip),
+			Ports:     ports(8080),
+		})
+		et.OnAdd(ep)
+		clock.Advance(time.Second)
+		return ep
+	}
+
+	// the least recently updated cluster is paused, so is kept.
+	paused := add("paused", "192.168.183.24")
+	et.PauseCluster("default/paused")
+	et.OnUpdate(paused, endpoints("default", "paused", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.25"),
+		Ports:     ports(8080),
+	}))
+	emptied := add("emptied", "192.168.183.26")
+	et.OnUpdate(emptied, endpoints("default", "emptied"))
+	clock.Advance(time.Second)
+
+	// the emptied cluster is evicted, and forgotten.
+	add("newest", "192.168.183.27")
+	want := []proto.Message{
+		clusterloadassignment("default/newest", lbendpoint("192.168.183.27", 8080)),
+		clusterloadassignment("default/paused", lbendpoint("192.168.183.24", 8080)),
+	}
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+	if len(et.emptied) != 0 {
+		t.Fatalf("expected evicted cluster to be forgotten, got %v", et.emptied)
+	}
+
+	// resuming publishes the held change, making newest the least
+	// recently updated cluster.
+	et.ResumeCluster("default/paused")
+	want = []proto.Message{
+		clusterloadassignment("default/paused", lbendpoint("192.168.183.24", 8080), lbendpoint("192.168.183.25", 8080)),
+	}
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorEmptyAddress(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("", "192.168.183.24"),
+		Ports:     ports(8080),
+	}))
+	want := []proto.Message{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorOrderEndpointsByHash(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger:          testLogger(t),
+		OrderEndpointsByHash: true,
+	}
+	var ips []string
+	for i := 1; i <= 50; i++ {
+		ips = append(ips, fmt.Sprintf("10.0.0.%d", i))
+	}
+	order := func() []string {
+		var got []string
+		for _, m := range contents(et) {
+			for _, lb := range m.(*v2.ClusterLoadAssignment).Endpoints[0].LbEndpoints {
+				got = append(got, lb.Endpoint.Address.GetSocketAddress().Address)
+			}
+		}
+		return got
+	}
+
+	before := endpoints("default", "ring", v1.EndpointSubset{
+		Addresses: addresses(ips...),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(before)
+	first := order()
+
+	// add one endpoint to the front of the list.
+	after := endpoints("default", "ring", v1.EndpointSubset{
+		Addresses: addresses(append([]string{"10.0.0.100"}, ips...)...),
+		Ports:     ports(8080),
+	})
+	et.OnUpdate(before, after)
+	second := order()
+
+	if len(second) != len(first)+1 {
+		t.Fatalf("expected %d endpoints, got %d", len(first)+1, len(second))
+	}
+	var without []string
+	for _, ip := range second {
+		if ip != "10.0.0.100" {
+			without = append(without, ip)
+		}
+	}
+	if !reflect.DeepEqual(first, without) {
+		t.Fatalf("expected relative order to be preserved:\nbefore: %v\nafter:  %v", first, without)
+	}
+	sorted := append([]string(nil), first...)
+	sort.Strings(sorted)
+	if reflect.DeepEqual(sorted, first) {
+		t.Fatalf("expected hash order to differ from address order: %v", first)
+	}
+}
+
+func TestEndpointsTranslatorDryRun(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	}))
+	live := contents(et)
+
+	got := et.DryRun(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.25"),
+		Ports: []v1.EndpointPort{{
+			Name: "https",
+			Port: 8443,
+		}, {
+			Name: "http",
+			Port: 8080,
+		}},
+	}))
+	want := []*v2.ClusterLoadAssignment{
+		clusterloadassignment("default/simple/http", lbendpoint("192.168.183.24", 8080), lbendpoint("192.168.183.25", 8080)),
+		clusterloadassignment("default/simple/https", lbendpoint("192.168.183.24", 8443), lbendpoint("192.168.183.25", 8443)),
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+	if after := contents(et); !reflect.DeepEqual(live, after) {
+		t.Fatalf("expected published state to be unchanged:\nbefore: %v\nafter:  %v", live, after)
+	}
+}
+
+func TestEndpointsTranslatorDryRunNoSideEffects(t *testing.T) {
+	hook := &logHook{level: logrus.WarnLevel}
+	log := logrus.New()
+	log.Out = &testWriter{t}
+	log.AddHook(hook)
+
+	r := prometheus.NewRegistry()
+	et := &EndpointsTranslator{
+		FieldLogger: log,
+		Metrics:     metrics.NewMetrics(r),
+	}
+	ep := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: append(addresses("192.168.183.24"), v1.EndpointAddress{Hostname: "broken"}),
+		Ports:     ports(8080),
+	})
+	ep.Annotations = map[string]string{
+		"contour.heptio.com/health-check-port": "65536",
+	}
+
+	got := et.DryRun(ep)
+	want := []*v2.ClusterLoadAssignment{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+	if len(hook.entries) != 0 {
+		t.Fatalf("expected no events, got %v", hook.entries)
+	}
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != metrics.MalformedEndpointsCounter {
+			continue
+		}
+		if got := mf.Metric[0].GetCounter().GetValue(); got != 0 {
+			t.Fatalf("expected no malformed endpoints to be recorded, got %v", got)
+		}
+	}
+}
+
+func TestEndpointsTranslatorEmitEmptyClusterLoadAssignment(t *testing.T) {
+	scaled := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	zero := endpoints("default", "simple")
+
+	tests := map[string]struct {
+		emitEmpty bool
+		want      []proto.Message
+	}{
+		"omit": {
+			emitEmpty: false,
+			want:      []proto.Message{},
+		},
+		"emit empty": {
+			emitEmpty: true,
+			want: []proto.Message{
+				&v2.ClusterLoadAssignment{ClusterName: "default/simple"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &EndpointsTranslator{
+				FieldLogger:                    testLogger(t),
+				EmitEmptyClusterLoadAssignment: tc.emitEmpty,
+			}
+			et.OnAdd(scaled)
+			et.OnUpdate(scaled, zero)
+			got := contents(et)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected:\n%v\ngot:\n%v", tc.want, got)
+			}
+
+			// deleting the Endpoints object always withdraws the cluster.
+			et.OnDelete(zero)
+			if got := contents(et); len(got) != 0 {
+				t.Fatalf("expected no clusters after delete, got %v", got)
+			}
+		})
+	}
+}
+
+func TestEndpointsTranslatorClusterEndpointsHistogram(t *testing.T) {
+	r := prometheus.NewRegistry()
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+		Metrics:     metrics.NewMetrics(r),
+	}
+	for _, size := range []int{1, 5, 50} {
+		var ips []string
+		for i := 0; i < size; i++ {
+			ips = append(ips, fmt.Sprintf("10.0.0.%d", i+1))
+		}
+		et.OnAdd(endpoints("default", fmt.Sprintf("size-%d", size), v1.EndpointSubset{
+			Addresses: addresses(ips...),
+			Ports:     ports(8080),
+		}))
+	}
+
+	// republishing a cluster must not add further observations.
+	for _, port := range []int32{8081, 8082, 8083} {
+		et.OnAdd(endpoints("default", "size-5", v1.EndpointSubset{
+			Addresses: addresses("10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"),
+			Ports:     ports(port),
+		}))
+	}
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[float64]uint64)
+	for _, mf := range mfs {
+		if mf.GetName() != metrics.ClusterEndpointsHistogram {
+			continue
+		}
+		h := mf.Metric[0].GetHistogram()
+		if h.GetSampleCount() != 3 || h.GetSampleSum() != 56 {
+			t.Fatalf("expected 3 clusters totalling 56, got %d totalling %v", h.GetSampleCount(), h.GetSampleSum())
+		}
+		for _, b := range h.Bucket {
+			got[b.GetUpperBound()] = b.GetCumulativeCount()
+		}
+	}
+	want := map[float64]uint64{
+		1: 1, 2: 1, 4: 1, 8: 2, 16: 2, 32: 2, 64: 3,
+		128: 3, 256: 3, 512: 3, 1024: 3, 2048: 3,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected buckets: %v, got: %v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorClusterMetrics(t *testing.T) {
+	r := prometheus.NewRegistry()
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+		Metrics:     metrics.NewMetrics(r),
+	}
+
+	// gauges returns the number of published ClusterLoadAssignments,
+	// and the endpoints gauge of each cluster.
+	gauges := func() (float64, map[string]float64) {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var total float64
+		counts := make(map[string]float64)
+		for _, mf := range mfs {
+			switch mf.GetName() {
+			case metrics.EDSClusterLoadAssignmentsGauge:
+				total = mf.Metric[0].GetGauge().GetValue()
+			case metrics.EDSEndpointsGauge:
+				for _, m := range mf.Metric {
+					counts[m.Label[0].GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+		return total, counts
+	}
+
+	simple := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.25"),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(simple)
+	et.OnAdd(endpoints("default", "other", v1.EndpointSubset{
+		Addresses: addresses("10.0.0.1"),
+		Ports:     ports(80),
+	}))
+
+	total, got := gauges()
+	if want := map[string]float64{"default/simple": 2, "default/other": 1}; total != 2 || !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected 2 clusters with endpoints %v, got %v clusters with endpoints %v", want, total, got)
+	}
+
+	et.OnDelete(simple)
+
+	total, got = gauges()
+	if want := map[string]float64{"default/other": 1}; total != 1 || !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected 1 cluster with endpoints %v, got %v clusters with endpoints %v", want, total, got)
+	}
+}
+
+func TestEndpointsTranslatorConsolidatePorts(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger:      testLogger(t),
+		ConsolidatePorts: true,
+	}
+	multi := endpoints("default", "multi", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports: []v1.EndpointPort{{
+			Name: "http",
+			Port: 8080,
+		}, {
+			Name: "https",
+			Port: 8443,
+		}},
+	})
+	et.OnAdd(multi)
+
+	port := func(lb endpoint.LbEndpoint, name string) endpoint.LbEndpoint {
+		setMetadata(&lb, "envoy.lb", "port", name)
+		return lb
+	}
+	want := []proto.Message{
+		clusterloadassignment("default/multi",
+			port(lbendpoint("192.168.183.24", 8080), "http"),
+			port(lbendpoint("192.168.183.24", 8443), "https"),
+		),
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+	if got := got[0].(*v2.ClusterLoadAssignment).Endpoints[0].LbEndpoints[1].Metadata.FilterMetadata["envoy.lb"].Fields["port"].GetStringValue(); got != "https" {
+		t.Fatalf("expected port metadata %q, got %q", "https", got)
+	}
+
+	// removing the service removes the consolidated cluster.
+	et.OnDelete(multi)
+	if got := contents(et); len(got) != 0 {
+		t.Fatalf("expected no clusters, got %v", got)
+	}
+}
+
+// logHook records the entries logged at or above a level.
+type logHook struct {
+	level   logrus.Level
+	entries []*logrus.Entry
+}
+
+func (h *logHook) Levels() []logrus.Level {
+	return logrus.AllLevels[:h.level+1]
+}
+
+func (h *logHook) Fire(e *logrus.Entry) error {
+	h.entries = append(h.entries, e)
+	return nil
+}
+
+func TestEndpointsTranslatorScaleToZero(t *testing.T) {
+	hook := &logHook{level: logrus.WarnLevel}
+	log := logrus.New()
+	log.Out = &testWriter{t}
+	log.AddHook(hook)
+
+	et := &EndpointsTranslator{
+		FieldLogger: log,
+	}
+	scaled := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.25", "192.168.183.26"),
+		Ports: []v1.EndpointPort{{
+			Name: "http",
+			Port: 8080,
+		}, {
+			Name: "https",
+			Port: 8443,
+		}},
+	})
+	zero := endpoints("default", "simple")
+	zero.ResourceVersion = "42"
+
+	et.OnAdd(scaled)
+	if len(hook.entries) != 0 {
+		t.Fatalf("expected no events, got %v", hook.entries)
+	}
+	et.OnUpdate(scaled, zero)
+	if len(hook.entries) != 1 {
+		t.Fatalf("expected one event, got %v", hook.entries)
+	}
+	want := logrus.Fields{
+		"namespace":          "default",
+		"name":               "simple",
+		"resource_version":   "42",
+		"previous_endpoints": 6,
+	}
+	if got := hook.entries[0].Data; !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+
+	// deleting the Endpoints object is not a scale to zero.
+	et.OnAdd(scaled)
+	et.OnDelete(scaled)
+	if len(hook.entries) != 1 {
+		t.Fatalf("expected no further events, got %v", hook.entries)
+	}
+}
+
+func TestEndpointsTranslatorNotReadyPriority(t *testing.T) {
+	tests := map[string]struct {
+		priority uint32
+		subset   v1.EndpointSubset
+		want     []proto.Message
+	}{
+		"not ready excluded": {
+			subset: v1.EndpointSubset{
+				Addresses:         addresses("192.168.183.24"),
+				NotReadyAddresses: addresses("192.168.183.25"),
+				Ports:             ports(8080),
+			},
+			want: []proto.Message{
+				clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+			},
+		},
+		"ready and not ready": {
+			priority: 1,
+			subset: v1.EndpointSubset{
+				Addresses:         addresses("192.168.183.24"),
+				NotReadyAddresses: addresses("192.168.183.25", "192.168.183.26"),
+				Ports:             ports(8080),
+			},
+			want: []proto.Message{
+				&v2.ClusterLoadAssignment{
+					ClusterName: "default/simple",
+					Endpoints: []endpoint.LocalityLbEndpoints{{
+						LbEndpoints: []endpoint.LbEndpoint{
+							lbendpoint("192.168.183.24", 8080),
+						},
+					}, {
+						LbEndpoints: []endpoint.LbEndpoint{
+							lbendpoint("192.168.183.25", 8080),
+							lbendpoint("192.168.183.26", 8080),
+						},
+						Priority: 1,
+					}},
+				},
+			},
+		},
+		"only not ready": {
+			priority: 1,
+			subset: v1.EndpointSubset{
+				NotReadyAddresses: addresses("192.168.183.25"),
+				Ports:             ports(8080),
+			},
+			want: []proto.Message{
+				&v2.ClusterLoadAssignment{
+					ClusterName: "default/simple",
+					Endpoints: []endpoint.LocalityLbEndpoints{{
+						// no ready endpoints at priority 0.
+					}, {
+						LbEndpoints: []endpoint.LbEndpoint{
+							lbendpoint("192.168.183.25", 8080),
+						},
+						Priority: 1,
+					}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &EndpointsTranslator{
+				FieldLogger:      testLogger(t),
+				NotReadyPriority: tc.priority,
+			}
+			et.OnAdd(endpoints("default", "simple", tc.subset))
+			got := contents(et)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected:\n%v\ngot:\n%v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEndpointsTranslatorIncludeNotReadyEndpoints(t *testing.T) {
+	healthy := func(ip string, port int32) endpoint.LbEndpoint {
+		lb := lbendpoint(ip, port)
+		lb.HealthStatus = core.HealthStatus_HEALTHY
+		return lb
+	}
+	unhealthy := func(ip string, port int32) endpoint.LbEndpoint {
+		lb := lbendpoint(ip, port)
+		lb.HealthStatus = core.HealthStatus_UNHEALTHY
+		return lb
+	}
+	subset := v1.EndpointSubset{
+		Addresses:         addresses("192.168.183.24"),
+		NotReadyAddresses: addresses("192.168.183.25", "192.168.183.26"),
+		Ports:             ports(8080),
+	}
+
+	tests := map[string]struct {
+		priority uint32
+		want     []proto.Message
+	}{
+		"alongside ready": {
+			want: []proto.Message{
+				clusterloadassignment("default/simple",
+					healthy("192.168.183.24", 8080),
+					unhealthy("192.168.183.25", 8080),
+					unhealthy("192.168.183.26", 8080),
+				),
+			},
+		},
+		"with not ready priority": {
+			priority: 2,
+			want: []proto.Message{
+				&v2.ClusterLoadAssignment{
+					ClusterName: "default/simple",
+					Endpoints: []endpoint.LocalityLbEndpoints{{
+						LbEndpoints: []endpoint.LbEndpoint{
+							healthy("192.168.183.24", 8080),
+						},
+					}, {
+						LbEndpoints: []endpoint.LbEndpoint{
+							unhealthy("192.168.183.25", 8080),
+							unhealthy("192.168.183.26", 8080),
+						},
+						Priority: 1,
+					}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &EndpointsTranslator{
+				FieldLogger:              testLogger(t),
+				IncludeNotReadyEndpoints: true,
+				NotReadyPriority:         tc.priority,
+			}
+			et.OnAdd(endpoints("default", "simple", subset))
+			got := contents(et)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected:\n%v\ngot:\n%v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEndpointsTranslatorExportImportState(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	}))
+	et.OnAdd(endpoints("default", "secure", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.25", "192.168.183.26"),
+		Ports: []v1.EndpointPort{{
+			Name: "https",
+			Port: 8443,
+		}},
+	}))
+
+	state := et.ExportState()
+	if state == nil {
+		t.Fatal("ExportState returned nil")
+	}
+
+	restored := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	if err := restored.ImportState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	want := contents(et)
+	got := contents(restored)
+	if len(want) != len(got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+	for i := range want {
+		if !proto.Equal(want[i], got[i]) {
+			t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+		}
+	}
+
+	// the restored version must not be older than the exported version.
+	ch := make(chan int, 1)
+	restored.Register(ch, 2)
+	select {
+	case <-ch:
+	default:
+		t.Fatal("expected restored translator to notify immediately")
+	}
+
+	if err := restored.ImportState([]byte("garbage")); err == nil {
+		t.Fatal("expected error importing invalid state")
+	}
+}
+
+func TestEndpointsTranslatorImportStateSynced(t *testing.T) {
+	simple := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	et.OnAdd(simple)
+	et.OnAdd(endpoints("default", "gone", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.25"),
+		Ports:     ports(8080),
+	}))
+
+	restored := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	if err := restored.ImportState(et.ExportState()); err != nil {
+		t.Fatal(err)
+	}
+	changes, cancel := restored.Subscribe()
+	defer cancel()
+
+	// default/gone was deleted while no translator was running.
+	restored.Synced([]interface{}{simple})
+
+	want := []proto.Message{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+	}
+	if got := contents(restored); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+	if c := <-changes; c.Type != ClusterRemoved || c.Name != "default/gone" || c.Reason != ImportReconciled {
+		t.Fatalf("expected default/gone to be withdrawn, got %v %v %v", c.Type, c.Name, c.Reason)
+	}
+}
+
+func TestEndpointsTranslatorServeStaleOnDisconnect(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger:            testLogger(t),
+		ServeStaleOnDisconnect: true,
+	}
+	e1 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(e1)
+
+	et.Disconnected(errors.New("connection refused"))
+
+	// the informer may still deliver events while disconnected, for
+	// example while replaying its local state.
+	et.OnDelete(e1)
+	e2 := endpoints("default", "other", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.25"),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(e2)
+
+	want := []proto.Message{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+
+	et.Reconnected(nil)
+
+	want = []proto.Message{
+		clusterloadassignment("default/other", lbendpoint("192.168.183.25", 8080)),
+	}
+	got = contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEndpointsTranslatorServeStaleRelist(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger:            testLogger(t),
+		ServeStaleOnDisconnect: true,
+	}
+	simple := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(simple)
+	et.OnAdd(endpoints("default", "gone", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.25"),
+		Ports:     ports(8080),
+	}))
+
+	et.Disconnected(errors.New("connection refused"))
+
+	// no events are delivered while disconnected; the relist on
+	// reconnection shows default/gone was deleted, and default/simple
+	// scaled up, before the corresponding events arrive.
+	scaled := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.26"),
+		Ports:     ports(8080),
+	})
+	et.Reconnected([]interface{}{scaled})
+
+	want := []proto.Message{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080), lbendpoint("192.168.183.26", 8080)),
+	}
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+
+	// the relisted events then leave the snapshot unchanged.
+	et.OnUpdate(simple, scaled)
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEndpointsTranslatorStripClusterNamePrefix(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger:            testLogger(t),
+		StripClusterNamePrefix: "kube-system/",
+	}
+	e1 := endpoints("kube-system", "kube-dns", v1.EndpointSubset{
+		Addresses: addresses("10.0.0.10"),
+		Ports: []v1.EndpointPort{{
+			Name: "dns-tcp",
+			Port: 53,
+		}},
+	})
+	e2 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(e1)
+	et.OnAdd(e2)
+
+	want := []proto.Message{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+		clusterloadassignment("kube-dns/dns-tcp", lbendpoint("10.0.0.10", 53)),
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+
+	// removal must use the stripped name.
+	et.OnDelete(e1)
+	want = []proto.Message{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+	}
+	got = contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEndpointsTranslatorClusterNameCollision(t *testing.T) {
+	hook := &logHook{level: logrus.WarnLevel}
+	log := logrus.New()
+	log.Out = &testWriter{t}
+	log.AddHook(hook)
+
+	r := prometheus.NewRegistry()
+	et := &EndpointsTranslator{
+		FieldLogger:            log,
+		StripClusterNamePrefix: "team-",
+		Metrics:                metrics.NewMetrics(r),
+	}
+	// both are published as "a/simple".
+	stripped := endpoints("team-a", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	unstripped := endpoints("a", "simple", v1.EndpointSubset{
+		Addresses: addresses("10.0.0.1"),
+		Ports:     ports(8080),
+	})
+
+	et.OnAdd(stripped)
+	if len(hook.entries) != 0 {
+		t.Fatalf("expected no events, got %v", hook.entries)
+	}
+	et.OnAdd(unstripped)
+	if len(hook.entries) != 1 {
+		t.Fatalf("expected one event, got %v", hook.entries)
+	}
+	fields := logrus.Fields{
+		"cluster": "a/simple",
+		"first":   "team-a/simple",
+		"second":  "a/simple",
+	}
+	if got := hook.entries[0].Data; !reflect.DeepEqual(fields, got) {
+		t.Fatalf("expected: %v, got: %v", fields, got)
+	}
+
+	// the most recent update wins.
+	want := []proto.Message{
+		clusterloadassignment("a/simple", lbendpoint("10.0.0.1", 8080)),
+	}
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+
+	// the collision is only reported once.
+	et.OnUpdate(stripped, stripped.DeepCopy())
+	if len(hook.entries) != 1 {
+		t.Fatalf("expected no further events, got %v", hook.entries)
+	}
+	want = []proto.Message{
+		clusterloadassignment("a/simple", lbendpoint("192.168.183.24", 8080)),
+	}
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conflicts float64
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case metrics.EndpointsClusterNameConflictsCounter:
+			conflicts = mf.Metric[0].GetCounter().GetValue()
+		case metrics.ClusterNameCollisionsCounter:
+			if got := mf.Metric[0].GetCounter().GetValue(); got != 0 {
+				t.Fatalf("expected no CDS collisions, got %v", got)
+			}
+		}
+	}
+	if conflicts != 1 {
+		t.Fatalf("expected 1 conflict, got %v", conflicts)
+	}
+}
+
+func TestEndpointsTranslatorPurgeNamespace(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger:            testLogger(t),
+		StripClusterNamePrefix: "kube-system/",
+	}
+	dns := endpoints("kube-system", "kube-dns", v1.EndpointSubset{
+		Addresses: addresses("10.0.0.10"),
+		Ports:     ports(53),
+	})
+	et.OnAdd(dns)
+	et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	}))
+
+	et.PurgeNamespace("kube-system")
+	want := []proto.Message{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+	}
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+
+	// the next event restores the purged cluster.
+	dns2 := endpoints("kube-system", "kube-dns", v1.EndpointSubset{
+		Addresses: addresses("10.0.0.10", "10.0.0.11"),
+		Ports:     ports(53),
+	})
+	et.OnUpdate(dns, dns2)
+	want = []proto.Message{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+		clusterloadassignment("kube-dns", lbendpoint("10.0.0.10", 53), lbendpoint("10.0.0.11", 53)),
+	}
+	got := contents(et)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorPurgeNamespaceSources(t *testing.T) {
+	exported := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	exported.OnAdd(endpoints("default", "imported", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.23"),
+		Ports:     ports(8080),
+	}))
+
+	et := &EndpointsTranslator{
+		FieldLogger:                    testLogger(t),
+		StripClusterNamePrefix:         "team-",
+		EmitEmptyClusterLoadAssignment: true,
+	}
+	if err := et.ImportState(exported.ExportState()); err != nil {
+		t.Fatal(err)
+	}
+	scaleToZero := func(ns, name, ip string) {
+		ep := endpoints(ns, name, v1.EndpointSubset{
+			Addresses: addresses(ip),
+			Ports:     ports(8080),
+		})
+		et.OnAdd(ep)
+		et.OnUpdate(ep, endpoints(ns, name))
+	}
+	scaleToZero("default", "empty", "192.168.183.24")
+	// published as default/other, but belongs to team-default.
+	scaleToZero("team-default", "other", "192.168.183.25")
+	et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.26"),
+		Ports:     ports(8080),
+	}))
+	et.OnAdd(endpoints("default-x", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.27"),
+		Ports:     ports(8080),
+	}))
+
+	et.PurgeNamespace("default")
+	want := []proto.Message{
+		clusterloadassignment("default-x/simple", lbendpoint("192.168.183.27", 8080)),
+		&v2.ClusterLoadAssignment{ClusterName: "default/other"},
+	}
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestEndpointsTranslatorCheckClusters(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	et.OnAdd(endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	}))
+	et.OnAdd(endpoints("default", "unreferenced", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.25"),
+		Ports:     ports(8080),
+	}))
+
+	unknown, missing := et.CheckClusters([]string{"default/simple", "default/scaled-to-zero"})
+	if want := []string{"default/unreferenced"}; !reflect.DeepEqual(want, unknown) {
+		t.Errorf("unknown: expected %v, got %v", want, unknown)
+	}
+	if want := []string{"default/scaled-to-zero"}; !reflect.DeepEqual(want, missing) {
+		t.Errorf("missing: expected %v, got %v", want, missing)
+	}
+
+	unknown, missing = et.CheckClusters([]string{"default/simple", "default/unreferenced"})
+	if len(unknown) != 0 || len(missing) != 0 {
+		t.Errorf("expected no mismatches, got unknown: %v, missing: %v", unknown, missing)
+	}
+}
+
+type clusterLoadAssignmentsByName []proto.Message
+
+func (c clusterLoadAssignmentsByName) Len() int      { return len(c) }
+func (c clusterLoadAssignmentsByName) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c clusterLoadAssignmentsByName) Less(i, j int) bool {
+	return c[i].(*v2.ClusterLoadAssignment).ClusterName < c[j].(*v2.ClusterLoadAssignment).ClusterName
+}
+
+func TestEndpointsTranslatorDeterministicOrder(t *testing.T) {
+	// the same endpoints, with their subsets, addresses, and services
+	// listed in a different order, as two contour processes might
+	// observe them across a restart.
+	a := []*v1.Endpoints{
+		endpoints("default", "simple", v1.EndpointSubset{
+			Addresses: addresses("192.168.183.24", "192.168.183.26"),
+			Ports:     ports(8080),
+		}, v1.EndpointSubset{
+			Addresses: addresses("10.0.0.9", "10.0.0.1"),
+			Ports:     ports(8080),
+		}),
+		endpoints("default", "kuard", v1.EndpointSubset{
+			Addresses: addresses("10.10.1.2", "10.10.1.1"),
+			Ports:     ports(80),
+		}),
+	}
+	b := []*v1.Endpoints{
+		endpoints("default", "kuard", v1.EndpointSubset{
+			Addresses: addresses("10.10.1.1", "10.10.1.2"),
+			Ports:     ports(80),
+		}),
+		endpoints("default", "simple", v1.EndpointSubset{
+			Addresses: addresses("10.0.0.1", "10.0.0.9"),
+			Ports:     ports(8080),
+		}, v1.EndpointSubset{
+			Addresses: addresses("192.168.183.26", "192.168.183.24"),
+			Ports:     ports(8080),
+		}),
+	}
+
+	for _, localityPerSubset := range []bool{false, true} {
+		t.Run(fmt.Sprintf("locality per subset %v", localityPerSubset), func(t *testing.T) {
+			marshal := func(eps []*v1.Endpoints) []byte {
+				et := &EndpointsTranslator{
+					FieldLogger:       testLogger(t),
+					LocalityPerSubset: localityPerSubset,
+				}
+				for _, ep := range eps {
+					et.OnAdd(ep)
+				}
+				var buf []byte
+				for _, v := range contents(et) {
+					b, err := proto.Marshal(v)
+					if err != nil {
+						t.Fatal(err)
+					}
+					buf = append(buf, b...)
+				}
+				return buf
+			}
+			got, want := marshal(a), marshal(b)
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("expected identical ClusterLoadAssignments, got:\n%x\nwant:\n%x", got, want)
+			}
+		})
+	}
 }
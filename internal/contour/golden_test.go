@@ -0,0 +1,67 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// golden compares got, marshalled to indented JSON, with the contents of
+// testdata/<test name>.golden. If the -update flag is set the golden file
+// is rewritten instead.
+func golden(t *testing.T, got []proto.Message) {
+	t.Helper()
+	var m jsonpb.Marshaler
+	msgs := make([]json.RawMessage, 0, len(got))
+	for _, msg := range got {
+		s, err := m.MarshalToString(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, json.RawMessage(s))
+	}
+	buf, err := json.MarshalIndent(msgs, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = append(buf, '\n')
+
+	path := filepath.Join("testdata", filepath.FromSlash(t.Name())+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run with -update to create it", err)
+	}
+	if string(want) != string(buf) {
+		t.Fatalf("%s: expected:\n%s\ngot:\n%s", path, want, buf)
+	}
+}
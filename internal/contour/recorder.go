@@ -0,0 +1,140 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/heptio/contour/internal/k8s"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	_cache "k8s.io/client-go/tools/cache"
+)
+
+// endpointsEvent is the serialised form of a single
+// ResourceEventHandler call recorded by an EndpointsRecorder.
+type endpointsEvent struct {
+	Op  string        `json:"op"`
+	Old *v1.Endpoints `json:"old,omitempty"`
+	New *v1.Endpoints `json:"new,omitempty"`
+}
+
+// EndpointsRecorder is a cache.ResourceEventHandler which writes each
+// v1.Endpoints event it receives to W, one JSON object per line, before
+// passing it on to Handler. A recording can be fed back into a fresh
+// handler with ReplayEndpoints. If Handler is a k8s.ConnectionObserver,
+// or a k8s.SyncObserver, those notifications are passed on to it too,
+// but are not recorded.
+type EndpointsRecorder struct {
+	logrus.FieldLogger
+	Handler _cache.ResourceEventHandler
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewEndpointsRecorder returns an EndpointsRecorder which records
+// to w and forwards events to h.
+func NewEndpointsRecorder(log logrus.FieldLogger, w io.Writer, h _cache.ResourceEventHandler) *EndpointsRecorder {
+	return &EndpointsRecorder{
+		FieldLogger: log,
+		Handler:     h,
+		enc:         json.NewEncoder(w),
+	}
+}
+
+func (r *EndpointsRecorder) OnAdd(obj interface{}) {
+	if ep, ok := obj.(*v1.Endpoints); ok {
+		r.record(endpointsEvent{Op: "add", New: ep})
+	}
+	r.Handler.OnAdd(obj)
+}
+
+func (r *EndpointsRecorder) OnUpdate(oldObj, newObj interface{}) {
+	oldEp, ok1 := oldObj.(*v1.Endpoints)
+	newEp, ok2 := newObj.(*v1.Endpoints)
+	if ok1 && ok2 {
+		r.record(endpointsEvent{Op: "update", Old: oldEp, New: newEp})
+	}
+	r.Handler.OnUpdate(oldObj, newObj)
+}
+
+func (r *EndpointsRecorder) OnDelete(obj interface{}) {
+	ep, ok := obj.(*v1.Endpoints)
+	if d, tombstone := obj.(_cache.DeletedFinalStateUnknown); tombstone {
+		ep, ok = d.Obj.(*v1.Endpoints)
+	}
+	if ok {
+		r.record(endpointsEvent{Op: "delete", Old: ep})
+	}
+	r.Handler.OnDelete(obj)
+}
+
+// Disconnected passes err on to Handler, if it is a k8s.ConnectionObserver.
+func (r *EndpointsRecorder) Disconnected(err error) {
+	if o, ok := r.Handler.(k8s.ConnectionObserver); ok {
+		o.Disconnected(err)
+	}
+}
+
+// Reconnected passes objs on to Handler, if it is a k8s.ConnectionObserver.
+func (r *EndpointsRecorder) Reconnected(objs []interface{}) {
+	if o, ok := r.Handler.(k8s.ConnectionObserver); ok {
+		o.Reconnected(objs)
+	}
+}
+
+// Synced passes objs on to Handler, if it is a k8s.SyncObserver.
+func (r *EndpointsRecorder) Synced(objs []interface{}) {
+	if o, ok := r.Handler.(k8s.SyncObserver); ok {
+		o.Synced(objs)
+	}
+}
+
+func (r *EndpointsRecorder) record(ev endpointsEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(&ev); err != nil {
+		r.WithError(err).Error("failed to record endpoints event")
+	}
+}
+
+// ReplayEndpoints reads a recording written by an EndpointsRecorder
+// from r and delivers each event, in order, to h.
+func ReplayEndpoints(r io.Reader, h _cache.ResourceEventHandler) error {
+	dec := json.NewDecoder(r)
+	for {
+		var ev endpointsEvent
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch ev.Op {
+		case "add":
+			h.OnAdd(ev.New)
+		case "update":
+			h.OnUpdate(ev.Old, ev.New)
+		case "delete":
+			h.OnDelete(ev.Old)
+		default:
+			return fmt.Errorf("unknown endpoints event %q", ev.Op)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/heptio/contour/internal/k8s"
+	"k8s.io/api/core/v1"
+	_cache "k8s.io/client-go/tools/cache"
+)
+
+func TestEndpointsRecorderReplay(t *testing.T) {
+	var buf bytes.Buffer
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	rec := NewEndpointsRecorder(testLogger(t), &buf, et)
+
+	simple := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	scaled := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.25"),
+		Ports:     ports(8080),
+	})
+	other := endpoints("default", "other", v1.EndpointSubset{
+		Addresses: addresses("10.0.0.1"),
+		Ports:     ports(80),
+	})
+	gone := endpoints("default", "gone", v1.EndpointSubset{
+		Addresses: addresses("10.0.0.2"),
+		Ports:     ports(80),
+	})
+
+	rec.OnAdd(simple)
+	rec.OnAdd(other)
+	rec.OnAdd(gone)
+	rec.OnUpdate(simple, scaled)
+	rec.OnDelete(_cache.DeletedFinalStateUnknown{Key: "default/gone", Obj: gone})
+
+	replayed := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	if err := ReplayEndpoints(&buf, replayed); err != nil {
+		t.Fatal(err)
+	}
+
+	want := contents(et)
+	got := contents(replayed)
+	if len(want) != 2 {
+		t.Fatalf("expected 2 recorded clusters, got %v", want)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestReplayEndpointsUnknownOp(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	err := ReplayEndpoints(bytes.NewBufferString(`{"op":"resync"}`+"\n"), et)
+	if err == nil {
+		t.Fatal("expected error replaying unknown op")
+	}
+}
+
+func TestEndpointsRecorderServeStaleOnDisconnect(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger:            testLogger(t),
+		ServeStaleOnDisconnect: true,
+	}
+	rec := NewEndpointsRecorder(testLogger(t), new(bytes.Buffer), et)
+	// the watcher only notifies handlers which are ConnectionObservers.
+	var _ k8s.ConnectionObserver = rec
+
+	simple := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(simple)
+
+	rec.Disconnected(errors.New("connection refused"))
+	rec.OnDelete(simple)
+
+	want := []proto.Message{
+		clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+	}
+	if got := contents(et); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected stale cluster to be served:\n%v\ngot:\n%v", want, got)
+	}
+
+	rec.Reconnected(nil)
+	if got := contents(et); len(got) != 0 {
+		t.Fatalf("expected no clusters after reconnect, got %v", got)
+	}
+}
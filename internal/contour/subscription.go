@@ -0,0 +1,224 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"sync"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
+)
+
+// subscriberBuffer is the number of ClusterChanges buffered for each
+// subscriber before the oldest are dropped.
+const subscriberBuffer = 128
+
+// ClusterChangeType describes how a published cluster changed.
+type ClusterChangeType int
+
+const (
+	ClusterAdded ClusterChangeType = iota
+	ClusterUpdated
+	ClusterRemoved
+)
+
+func (t ClusterChangeType) String() string {
+	switch t {
+	case ClusterAdded:
+		return "added"
+	case ClusterUpdated:
+		return "updated"
+	case ClusterRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// ChangeReason describes why a published cluster changed.
+type ChangeReason int
+
+const (
+	// EndpointsChanged is reported when an Endpoints object is added,
+	// updated, or deleted.
+	EndpointsChanged ChangeReason = iota
+
+	// ClusterResumed is reported when a change held back by
+	// PauseCluster is published by ResumeCluster.
+	ClusterResumed
+
+	// InformerReconnected is reported when changes held back while the
+	// Endpoints informer was disconnected are published, or when clusters
+	// are reconciled with the Endpoints objects relisted on reconnection.
+	InformerReconnected
+
+	// StateImported is reported for clusters restored by ImportState.
+	StateImported
+
+	// ClusterEvicted is reported when a cluster is removed because
+	// MaxClusters was exceeded.
+	ClusterEvicted
+
+	// NamespacePurged is reported for clusters removed by PurgeNamespace.
+	NamespacePurged
+
+	// ImportReconciled is reported for clusters restored by ImportState
+	// which no Endpoints object produced once the informer synced.
+	ImportReconciled
+)
+
+func (r ChangeReason) String() string {
+	switch r {
+	case EndpointsChanged:
+		return "EndpointsChanged"
+	case ClusterResumed:
+		return "ClusterResumed"
+	case InformerReconnected:
+		return "InformerReconnected"
+	case StateImported:
+		return "StateImported"
+	case ClusterEvicted:
+		return "ClusterEvicted"
+	case NamespacePurged:
+		return "NamespacePurged"
+	case ImportReconciled:
+		return "ImportReconciled"
+	default:
+		return "unknown"
+	}
+}
+
+// A ClusterChange describes a change to a published ClusterLoadAssignment.
+type ClusterChange struct {
+	Type   ClusterChangeType
+	Name   string
+	Reason ChangeReason
+
+	// ClusterLoadAssignment is the newly published value,
+	// or nil if the cluster was removed.
+	ClusterLoadAssignment *v2.ClusterLoadAssignment
+}
+
+// A ClusterCount summarises a change to a published
+// ClusterLoadAssignment for observers which do not need the
+// ClusterLoadAssignment itself.
+type ClusterCount struct {
+	Name string
+
+	// Endpoints is the number of endpoints now published for the
+	// cluster, or zero if the cluster was removed.
+	Endpoints int
+
+	// Version increases by one with each change published by
+	// the EndpointsTranslator, across all clusters.
+	Version uint64
+}
+
+// Subscribe returns a channel which receives a ClusterChange each time a
+// ClusterLoadAssignment is published or removed, and a function which
+// cancels the subscription and closes the channel.
+//
+// Publishing never waits for a subscriber. If a subscriber falls more than
+// subscriberBuffer changes behind, its oldest changes are dropped.
+func (e *EndpointsTranslator) Subscribe() (<-chan ClusterChange, func()) {
+	ch := make(chan ClusterChange, subscriberBuffer)
+	e.mu.Lock()
+	if e.subscribers == nil {
+		e.subscribers = make(map[chan ClusterChange]struct{})
+	}
+	e.subscribers[ch] = struct{}{}
+	e.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			e.mu.Lock()
+			delete(e.subscribers, ch)
+			close(ch)
+			e.mu.Unlock()
+		})
+	}
+}
+
+// SubscribeCounts is like Subscribe, but each change is delivered as a
+// ClusterCount carrying only the cluster's name and endpoint count.
+func (e *EndpointsTranslator) SubscribeCounts() (<-chan ClusterCount, func()) {
+	ch := make(chan ClusterCount, subscriberBuffer)
+	e.mu.Lock()
+	if e.countSubscribers == nil {
+		e.countSubscribers = make(map[chan ClusterCount]struct{})
+	}
+	e.countSubscribers[ch] = struct{}{}
+	e.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			e.mu.Lock()
+			delete(e.countSubscribers, ch)
+			close(ch)
+			e.mu.Unlock()
+		})
+	}
+}
+
+// publish delivers c to each subscriber. Callers must hold e.mu.
+func (e *EndpointsTranslator) publish(c ClusterChange) {
+	e.WithField("cluster", c.Name).WithField("change", c.Type).WithField("reason", c.Reason).Debug("cluster changed")
+	e.version++
+	e.publishCount(c)
+	for ch := range e.subscribers {
+		select {
+		case ch <- c:
+		default:
+			// the subscriber is full, drop its oldest change to make room.
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- c:
+			default:
+			}
+		}
+	}
+}
+
+// publishCount delivers a ClusterCount for c to each count subscriber.
+// Callers must hold e.mu.
+func (e *EndpointsTranslator) publishCount(c ClusterChange) {
+	if len(e.countSubscribers) == 0 {
+		return
+	}
+	count := ClusterCount{Name: c.Name, Version: e.version}
+	if c.ClusterLoadAssignment != nil {
+		for _, lle := range c.ClusterLoadAssignment.Endpoints {
+			count.Endpoints += len(lle.LbEndpoints)
+		}
+	}
+	for ch := range e.countSubscribers {
+		select {
+		case ch <- count:
+		default:
+			// the subscriber is full, drop its oldest count to make room.
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- count:
+			default:
+			}
+		}
+	}
+}
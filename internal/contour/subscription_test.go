@@ -0,0 +1,159 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestEndpointsTranslatorSubscribe(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	changes, cancel := et.Subscribe()
+
+	e1 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	e2 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.25"),
+		Ports:     ports(8080),
+	})
+	et.OnAdd(e1)
+	et.OnUpdate(e1, e2)
+	et.OnDelete(e2)
+
+	want := []ClusterChange{{
+		Type:                  ClusterAdded,
+		Name:                  "default/simple",
+		ClusterLoadAssignment: clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080)),
+	}, {
+		Type:                  ClusterUpdated,
+		Name:                  "default/simple",
+		ClusterLoadAssignment: clusterloadassignment("default/simple", lbendpoint("192.168.183.24", 8080), lbendpoint("192.168.183.25", 8080)),
+	}, {
+		Type: ClusterRemoved,
+		Name: "default/simple",
+	}}
+
+	cancel()
+	var got []ClusterChange
+	for c := range changes {
+		got = append(got, c)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEndpointsTranslatorSubscribeDropsOldest(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	changes, cancel := et.Subscribe()
+	defer cancel()
+
+	e1 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	// each add and delete publishes one change, overflow the buffer
+	// without reading from it.
+	for i := 0; i < subscriberBuffer; i++ {
+		et.OnAdd(e1)
+		et.OnDelete(e1)
+	}
+
+	if len(changes) != subscriberBuffer {
+		t.Fatalf("expected %d buffered changes, got %d", subscriberBuffer, len(changes))
+	}
+	// the oldest changes were dropped, the first remaining is an add
+	// from the second half of the loop.
+	if c := <-changes; c.Type != ClusterAdded {
+		t.Fatalf("expected %v, got %v", ClusterAdded, c.Type)
+	}
+}
+
+func TestEndpointsTranslatorSubscribeReason(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	changes, cancel := et.Subscribe()
+	defer cancel()
+
+	e1 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	e2 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.25"),
+		Ports:     ports(8080),
+	})
+
+	et.OnAdd(e1)
+	if c := <-changes; c.Reason != EndpointsChanged {
+		t.Fatalf("expected %v, got %v", EndpointsChanged, c.Reason)
+	}
+
+	et.PauseCluster("default/simple")
+	et.OnUpdate(e1, e2)
+	et.ResumeCluster("default/simple")
+	if c := <-changes; c.Reason != ClusterResumed {
+		t.Fatalf("expected %v, got %v", ClusterResumed, c.Reason)
+	}
+}
+
+func TestEndpointsTranslatorSubscribeCounts(t *testing.T) {
+	et := &EndpointsTranslator{
+		FieldLogger: testLogger(t),
+	}
+	counts, cancel := et.SubscribeCounts()
+
+	e1 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24"),
+		Ports:     ports(8080),
+	})
+	e2 := endpoints("default", "simple", v1.EndpointSubset{
+		Addresses: addresses("192.168.183.24", "192.168.183.25", "192.168.183.26"),
+		Ports:     ports(8080),
+	})
+	other := endpoints("default", "other", v1.EndpointSubset{
+		Addresses: addresses("10.0.0.1", "10.0.0.2"),
+		Ports:     ports(80),
+	})
+	et.OnAdd(e1)
+	et.OnAdd(other)
+	et.OnUpdate(e1, e2)
+	et.OnDelete(other)
+
+	want := []ClusterCount{
+		{Name: "default/simple", Endpoints: 1, Version: 1},
+		{Name: "default/other", Endpoints: 2, Version: 2},
+		{Name: "default/simple", Endpoints: 3, Version: 3},
+		{Name: "default/other", Endpoints: 0, Version: 4},
+	}
+
+	cancel()
+	var got []ClusterCount
+	for c := range counts {
+		got = append(got, c)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v\n", want, got)
+	}
+}
@@ -16,11 +16,15 @@
 package debug
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/pprof"
 
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/gogo/protobuf/jsonpb"
 	"github.com/heptio/contour/internal/dag"
 	"github.com/heptio/contour/internal/httpsvc"
+	"k8s.io/api/core/v1"
 )
 
 // Service serves various http endpoints including /debug/pprof.
@@ -28,6 +32,15 @@ type Service struct {
 	httpsvc.Service
 
 	*dag.Builder
+
+	// Endpoints, if set, serves /debug/eds/dryrun.
+	Endpoints EndpointsDryRunner
+}
+
+// An EndpointsDryRunner translates an Endpoints object into the
+// ClusterLoadAssignments it would produce, without publishing them.
+type EndpointsDryRunner interface {
+	DryRun(*v1.Endpoints) []*v2.ClusterLoadAssignment
 }
 
 // Start fulfills the g.Start contract.
@@ -35,6 +48,9 @@ type Service struct {
 func (svc *Service) Start(stop <-chan struct{}) error {
 	registerProfile(&svc.ServeMux)
 	registerDotWriter(&svc.ServeMux, svc.Builder)
+	if svc.Endpoints != nil {
+		registerEndpointsDryRun(&svc.ServeMux, svc.Endpoints)
+	}
 	return svc.Service.Start(stop)
 }
 
@@ -58,3 +74,33 @@ func registerDotWriter(mux *http.ServeMux, b *dag.Builder) {
 		dw.writeDot(w)
 	})
 }
+
+// registerEndpointsDryRun registers a handler which accepts a JSON
+// encoded v1.Endpoints object and responds with a JSON array of the
+// ClusterLoadAssignments it would produce.
+func registerEndpointsDryRun(mux *http.ServeMux, dr EndpointsDryRunner) {
+	mux.HandleFunc("/debug/eds/dryrun", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var ep v1.Endpoints
+		if err := json.NewDecoder(r.Body).Decode(&ep); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var m jsonpb.Marshaler
+		clas := make([]json.RawMessage, 0)
+		for _, cla := range dr.DryRun(&ep) {
+			s, err := m.MarshalToString(cla)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			clas = append(clas, json.RawMessage(s))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(clas)
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"k8s.io/api/core/v1"
+)
+
+type dryRunFunc func(*v1.Endpoints) []*v2.ClusterLoadAssignment
+
+func (f dryRunFunc) DryRun(ep *v1.Endpoints) []*v2.ClusterLoadAssignment { return f(ep) }
+
+func TestEndpointsDryRun(t *testing.T) {
+	var mux http.ServeMux
+	registerEndpointsDryRun(&mux, dryRunFunc(func(ep *v1.Endpoints) []*v2.ClusterLoadAssignment {
+		return []*v2.ClusterLoadAssignment{{
+			ClusterName: ep.Namespace + "/" + ep.Name,
+		}}
+	}))
+
+	tests := map[string]struct {
+		method string
+		body   string
+		status int
+		want   string
+	}{
+		"post endpoints": {
+			method: "POST",
+			body:   `{"metadata":{"name":"simple","namespace":"default"}}`,
+			status: http.StatusOK,
+			want:   `[{"clusterName":"default/simple"}]` + "\n",
+		},
+		"malformed body": {
+			method: "POST",
+			body:   `{`,
+			status: http.StatusBadRequest,
+		},
+		"get": {
+			method: "GET",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/debug/eds/dryrun", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rec.Code, rec.Body)
+			}
+			if tc.want != "" && rec.Body.String() != tc.want {
+				t.Fatalf("expected: %q, got: %q", tc.want, rec.Body.String())
+			}
+		})
+	}
+}
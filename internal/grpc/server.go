@@ -14,9 +14,14 @@ package grpc
 
 import (
 	"context"
+	"crypto/subtle"
+	"math/rand"
+	"strings"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
@@ -29,9 +34,48 @@ const (
 	grpcMaxConcurrentStreams = 1 << 20
 )
 
+// An Option configures the *grpc.Server returned by NewAPI.
+type Option func(*apiOptions)
+
+type apiOptions struct {
+	server []grpc.ServerOption
+	jitter time.Duration
+}
+
+// ServerOptions returns an Option which applies opts to the
+// *grpc.Server after Contour's defaults.
+func ServerOptions(opts ...grpc.ServerOption) Option {
+	return func(o *apiOptions) {
+		o.server = append(o.server, opts...)
+	}
+}
+
+// PushJitter returns an Option which delays the first response on each
+// xDS stream by a random duration in the range [0, max). A max of zero
+// disables the delay.
+func PushJitter(max time.Duration) Option {
+	return func(o *apiOptions) {
+		o.jitter = max
+	}
+}
+
+// Compression returns an Option which gzip compresses every xDS
+// response, and accepts gzip compressed requests. Large EDS snapshots
+// benefit the most. Compression is off by default.
+func Compression() Option {
+	return ServerOptions(
+		grpc.RPCCompressor(grpc.NewGZIPCompressor()),
+		grpc.RPCDecompressor(grpc.NewGZIPDecompressor()),
+	)
+}
+
 // NewAPI returns a *grpc.Server which responds to the Envoy v2 xDS gRPC API.
-func NewAPI(log logrus.FieldLogger, cacheMap map[string]Cache) *grpc.Server {
-	opts := []grpc.ServerOption{
+func NewAPI(log logrus.FieldLogger, cacheMap map[string]Cache, options ...Option) *grpc.Server {
+	var o apiOptions
+	for _, opt := range options {
+		opt(&o)
+	}
+	opts := append([]grpc.ServerOption{
 		// By default the Go grpc library defaults to a value of ~100 streams per
 		// connection. This number is likely derived from the HTTP/2 spec:
 		// https://http2.github.io/http2-spec/#SettingValues
@@ -39,11 +83,12 @@ func NewAPI(log logrus.FieldLogger, cacheMap map[string]Cache) *grpc.Server {
 		// CDS entry. There doesn't seem to be a penalty for increasing this value,
 		// so set it the limit similar to envoyproxy/go-control-plane#70.
 		grpc.MaxConcurrentStreams(grpcMaxConcurrentStreams),
-	}
+	}, o.server...)
 	g := grpc.NewServer(opts...)
 	s := &grpcServer{
 		xdsHandler{
 			FieldLogger: log,
+			jitter:      randomJitter(o.jitter),
 			resources: map[string]resource{
 				clusterType: &CDS{
 					Cache: cacheMap[clusterType],
@@ -68,6 +113,63 @@ func NewAPI(log logrus.FieldLogger, cacheMap map[string]Cache) *grpc.Server {
 	return g
 }
 
+// randomJitter returns a function which returns a random duration in the
+// range [0, max), or nil if max is not positive.
+func randomJitter(max time.Duration) func() time.Duration {
+	if max <= 0 {
+		return nil
+	}
+	return func() time.Duration {
+		return time.Duration(rand.Int63n(int64(max)))
+	}
+}
+
+// MaxSendMsgSize returns a grpc.ServerOption which limits the size of
+// messages, in bytes, the xDS server will send. By default the gRPC
+// library does not limit the size of messages sent; the well known
+// 4MiB limit applies to the receiving side, and must be raised there.
+func MaxSendMsgSize(n int) grpc.ServerOption {
+	return grpc.MaxSendMsgSize(n)
+}
+
+// TokenAuth returns the grpc.ServerOptions which reject any xDS request
+// whose authorization metadata is not "Bearer <token>", with
+// codes.Unauthenticated. Token authentication is opt-in, and should be
+// used with TLS so the token is not sent in the clear. If token is empty
+// every request is rejected.
+func TokenAuth(token string) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := authenticate(ctx, token); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := authenticate(ss.Context(), token); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// authenticate returns an Unauthenticated error unless ctx carries
+// token, which must not be empty, as a bearer token.
+func authenticate(ctx context.Context, token string) error {
+	if token == "" {
+		return status.Errorf(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md["authorization"] {
+		const prefix = "Bearer "
+		if strings.HasPrefix(v, prefix) && subtle.ConstantTimeCompare([]byte(v[len(prefix):]), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Errorf(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
 // grpcServer implements the LDS, RDS, CDS, and EDS, gRPC endpoints.
 type grpcServer struct {
 	xdsHandler
@@ -15,18 +15,23 @@ package grpc
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/gogo/protobuf/types"
 	"github.com/heptio/contour/internal/contour"
 	"github.com/heptio/contour/internal/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
@@ -309,6 +314,179 @@ func TestGRPCFetching(t *testing.T) {
 	}
 }
 
+func TestGRPCCompression(t *testing.T) {
+	tests := map[string]struct {
+		opts []Option
+		want bool // response is gzip compressed
+	}{
+		"default": {
+			want: false,
+		},
+		"compression": {
+			opts: []Option{Compression()},
+			want: true,
+		},
+	}
+
+	log := testLogger(t)
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &contour.EndpointsTranslator{
+				FieldLogger: log,
+			}
+			et.OnAdd(&v1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "kube-scheduler",
+					Namespace: "kube-system",
+				},
+				Subsets: []v1.EndpointSubset{{
+					Addresses: []v1.EndpointAddress{{
+						IP: "130.211.139.167",
+					}},
+					Ports: []v1.EndpointPort{{
+						Port: 80,
+					}},
+				}},
+			})
+
+			srv := NewAPI(log, map[string]Cache{
+				endpointType: et,
+			}, tc.opts...)
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			check(t, err)
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				srv.Serve(l)
+			}()
+			defer func() {
+				srv.Stop()
+				wg.Wait()
+				l.Close()
+			}()
+
+			// dc is only used to decode responses sent gzip compressed.
+			dc := &countingDecompressor{Decompressor: grpc.NewGZIPDecompressor()}
+			cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure(), grpc.WithDecompressor(dc))
+			check(t, err)
+			defer cc.Close()
+			eds := v2.NewEndpointDiscoveryServiceClient(cc)
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			stream, err := eds.StreamEndpoints(ctx)
+			check(t, err)
+			sendreq(t, stream, endpointType)
+			resp, err := stream.Recv()
+			check(t, err)
+
+			if got := atomic.LoadInt32(&dc.n) > 0; got != tc.want {
+				t.Fatalf("expected compressed response: %v, got: %v", tc.want, got)
+			}
+			if len(resp.Resources) != 1 {
+				t.Fatalf("expected 1 resource, got %d", len(resp.Resources))
+			}
+			var cla v2.ClusterLoadAssignment
+			check(t, types.UnmarshalAny(&resp.Resources[0], &cla))
+			if cla.ClusterName != "kube-system/kube-scheduler" {
+				t.Fatalf("expected cluster %q, got %q", "kube-system/kube-scheduler", cla.ClusterName)
+			}
+		})
+	}
+}
+
+// countingDecompressor counts the messages it decompresses.
+type countingDecompressor struct {
+	grpc.Decompressor
+	n int32
+}
+
+func (d *countingDecompressor) Do(r io.Reader) ([]byte, error) {
+	atomic.AddInt32(&d.n, 1)
+	return d.Decompressor.Do(r)
+}
+
+func TestGRPCMaxSendMsgSize(t *testing.T) {
+	// a snapshot of a single cluster with 1,000 endpoints, roughly 30KiB.
+	var addrs []v1.EndpointAddress
+	for i := 0; i < 1000; i++ {
+		addrs = append(addrs, v1.EndpointAddress{
+			IP: fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff),
+		})
+	}
+	ep := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "large",
+			Namespace: "default",
+		},
+		Subsets: []v1.EndpointSubset{{
+			Addresses: addrs,
+			Ports: []v1.EndpointPort{{
+				Port: 8080,
+			}},
+		}},
+	}
+
+	tests := map[string]struct {
+		opts []grpc.ServerOption
+		want codes.Code
+	}{
+		"default": {
+			want: codes.OK,
+		},
+		"too small": {
+			opts: []grpc.ServerOption{MaxSendMsgSize(16 << 10)},
+			want: codes.ResourceExhausted,
+		},
+		"large enough": {
+			opts: []grpc.ServerOption{MaxSendMsgSize(1 << 20)},
+			want: codes.OK,
+		},
+	}
+
+	log := testLogger(t)
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			et := &contour.EndpointsTranslator{
+				FieldLogger: log,
+			}
+			et.OnAdd(ep)
+			srv := NewAPI(log, map[string]Cache{
+				endpointType: et,
+			}, ServerOptions(tc.opts...))
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			check(t, err)
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				srv.Serve(l)
+			}()
+			defer func() {
+				srv.Stop()
+				wg.Wait()
+				l.Close()
+			}()
+
+			cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+			check(t, err)
+			defer cc.Close()
+			eds := v2.NewEndpointDiscoveryServiceClient(cc)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			stream, err := eds.StreamEndpoints(ctx)
+			check(t, err)
+			// Send may fail with io.EOF if the server has already
+			// rejected the stream; the status is reported by Recv.
+			stream.Send(&v2.DiscoveryRequest{TypeUrl: endpointType})
+			_, err = stream.Recv()
+			if got := status.Code(err); got != tc.want {
+				t.Fatalf("expected %v, got %v: %v", tc.want, got, err)
+			}
+		})
+	}
+}
+
 func check(t *testing.T, err error) {
 	t.Helper()
 	if err != nil {
@@ -366,3 +544,76 @@ func (t *testWriter) Write(buf []byte) (int, error) {
 	t.Logf("%s", buf)
 	return len(buf), nil
 }
+
+func TestGRPCTokenAuth(t *testing.T) {
+	log := testLogger(t)
+	et := &contour.EndpointsTranslator{
+		FieldLogger: log,
+	}
+	srv := NewAPI(log, map[string]Cache{
+		endpointType: et,
+	}, ServerOptions(TokenAuth("s3cr3t")...))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	check(t, err)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		srv.Serve(l)
+	}()
+	defer func() {
+		srv.Stop()
+		wg.Wait()
+		l.Close()
+	}()
+
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	check(t, err)
+	defer cc.Close()
+	eds := v2.NewEndpointDiscoveryServiceClient(cc)
+
+	tests := map[string]struct {
+		md   metadata.MD
+		want codes.Code
+	}{
+		"missing token": {
+			want: codes.Unauthenticated,
+		},
+		"wrong token": {
+			md:   metadata.Pairs("authorization", "Bearer guess"),
+			want: codes.Unauthenticated,
+		},
+		"empty token": {
+			md:   metadata.Pairs("authorization", "Bearer "),
+			want: codes.Unauthenticated,
+		},
+		"valid token": {
+			md:   metadata.Pairs("authorization", "Bearer s3cr3t"),
+			want: codes.OK,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			ctx = metadata.NewOutgoingContext(ctx, tc.md)
+			stream, err := eds.StreamEndpoints(ctx)
+			check(t, err)
+			sendreq(t, stream, endpointType)
+			_, err = stream.Recv()
+			if got := status.Code(err); got != tc.want {
+				t.Fatalf("expected %v, got %v: %v", tc.want, got, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateEmptyToken(t *testing.T) {
+	for _, v := range []string{"Bearer ", "Bearer", ""} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", v))
+		if got := status.Code(authenticate(ctx, "")); got != codes.Unauthenticated {
+			t.Fatalf("authorization %q: expected %v, got %v", v, codes.Unauthenticated, got)
+		}
+	}
+}
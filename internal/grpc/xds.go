@@ -17,6 +17,7 @@ import (
 	"context"
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	"github.com/sirupsen/logrus"
@@ -30,6 +31,12 @@ type xdsHandler struct {
 	logrus.FieldLogger
 	connections counter
 	resources   map[string]resource // registered resource types
+
+	// jitter, if set, returns the delay applied before the first
+	// response on each stream. Staggering the first responses stops
+	// many Envoys which reconnect at the same time from ACKing, and
+	// re-requesting, in lockstep.
+	jitter func() time.Duration
 }
 
 // fetch handles a single DiscoveryRequest.
@@ -77,6 +84,9 @@ func (xh *xdsHandler) stream(st grpcStream) (err error) {
 	last := -1
 	ctx := st.Context()
 
+	// jitter is cleared once the first response has been delayed.
+	jitter := xh.jitter
+
 	// now stick in this loop until the client disconnects.
 	for {
 		// first we wait for the request from Envoy, this is part of
@@ -109,6 +119,15 @@ func (xh *xdsHandler) stream(st grpcStream) (err error) {
 				// TODO(dfc) the thing that has changed may not be in the scope of the filter
 				// so we're going to be sending an update that is a no-op. See #426
 
+				if jitter != nil {
+					select {
+					case <-time.After(jitter()):
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+					jitter = nil
+				}
+
 				// generate a filter from the request, then call toAny which
 				// will get r's (our resource) filter values, then convert them
 				// to the types.Any from required by gRPC.
@@ -19,6 +19,7 @@ import (
 	"io"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	"github.com/gogo/protobuf/proto"
@@ -185,6 +186,68 @@ func TestXDSHandlerStream(t *testing.T) {
 	}
 }
 
+func TestXDSHandlerStreamJitter(t *testing.T) {
+	// events records, in order, each call to the jitter function and
+	// each response sent.
+	var events []string
+	xh := xdsHandler{
+		FieldLogger: testLogger(t),
+		resources: map[string]resource{
+			"com.heptio.potato": &mockResource{
+				register: func(ch chan int, last int) {
+					ch <- last + 1
+				},
+				values: func(func(string) bool) []proto.Message {
+					return nil
+				},
+				typeurl: func() string { return "com.heptio.potato" },
+			},
+		},
+		jitter: func() time.Duration {
+			events = append(events, "jitter")
+			return 0
+		},
+	}
+	sent := 0
+	err := xh.stream(&mockStream{
+		context: context.Background,
+		recv: func() (*v2.DiscoveryRequest, error) {
+			return &v2.DiscoveryRequest{
+				TypeUrl: "com.heptio.potato",
+			}, nil
+		},
+		send: func(resp *v2.DiscoveryResponse) error {
+			events = append(events, "send")
+			if sent++; sent == 3 {
+				return io.EOF
+			}
+			return nil
+		},
+	})
+	if err != io.EOF {
+		t.Fatalf("expected %v, got %v", io.EOF, err)
+	}
+
+	// only the first response on the stream is delayed.
+	want := []string{"jitter", "send", "send", "send"}
+	if !reflect.DeepEqual(want, events) {
+		t.Fatalf("expected: %v, got: %v", want, events)
+	}
+}
+
+func TestRandomJitter(t *testing.T) {
+	if randomJitter(0) != nil {
+		t.Fatal("expected zero jitter to be disabled")
+	}
+	const max = 10 * time.Millisecond
+	jitter := randomJitter(max)
+	for i := 0; i < 100; i++ {
+		if d := jitter(); d < 0 || d >= max {
+			t.Fatalf("expected jitter in [0, %v), got %v", max, d)
+		}
+	}
+}
+
 type mockStream struct {
 	context func() context.Context
 	send    func(*v2.DiscoveryResponse) error
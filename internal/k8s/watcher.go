@@ -15,6 +15,7 @@
 package k8s
 
 import (
+	"sync/atomic"
 	"time"
 
 	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
@@ -24,9 +25,13 @@ import (
 
 	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	k8swatch "k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -50,22 +55,138 @@ func WatchSecrets(g *workgroup.Group, client *kubernetes.Clientset, log logrus.F
 	watch(g, client.CoreV1().RESTClient(), log, "secrets", new(v1.Secret), rs...)
 }
 
+// WatchPods creates a SharedInformer for v1.Pods, registers it with g,
+// and returns a PodLister backed by the informer's cache.
+func WatchPods(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, rs ...cache.ResourceEventHandler) listers.PodLister {
+	sw := watch(g, client.CoreV1().RESTClient(), log, "pods", new(v1.Pod), rs...)
+	return listers.NewPodLister(sw.GetIndexer())
+}
+
+// WatchNodes creates a SharedInformer for v1.Nodes, registers it with g,
+// and returns a NodeLister backed by the informer's cache.
+func WatchNodes(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, rs ...cache.ResourceEventHandler) listers.NodeLister {
+	sw := watch(g, client.CoreV1().RESTClient(), log, "nodes", new(v1.Node), rs...)
+	return listers.NewNodeLister(sw.GetIndexer())
+}
+
 // WatchIngressRoutes creates a SharedInformer for contour.heptio.com/v1.IngressRoutes and registers it with g.
 func WatchIngressRoutes(g *workgroup.Group, client *clientset.Clientset, log logrus.FieldLogger, rs ...cache.ResourceEventHandler) {
 	watch(g, client.ContourV1beta1().RESTClient(), log, ingressroutev1.ResourcePlural, new(ingressroutev1.IngressRoute), rs...)
 }
 
-func watch(g *workgroup.Group, c cache.Getter, log logrus.FieldLogger, resource string, objType runtime.Object, rs ...cache.ResourceEventHandler) {
-	lw := cache.NewListWatchFromClient(c, resource, v1.NamespaceAll, fields.Everything())
-	sw := cache.NewSharedInformer(lw, objType, time.Duration(0)) // resync timer disabled
+// A ConnectionObserver is notified when an informer loses, and later
+// regains, its connection to the API server. Any ResourceEventHandler
+// passed to a Watch function which also implements ConnectionObserver
+// is notified.
+type ConnectionObserver interface {
+	// Disconnected is called when listing or watching the API server fails.
+	Disconnected(err error)
+
+	// Reconnected is called when a list or watch next succeeds. If the
+	// informer relisted, objs holds every object listed, which replaces
+	// the informer's previous state; the corresponding events are
+	// delivered after Reconnected returns. If the informer resumed its
+	// watch, objs is nil and events continue from where they stopped.
+	Reconnected(objs []interface{})
+}
+
+// A SyncObserver is notified once an informer has listed the API server
+// for the first time. Any ResourceEventHandler passed to a Watch function
+// which also implements SyncObserver is notified.
+type SyncObserver interface {
+	// Synced is called with every object in the informer's cache
+	// once the initial list has been processed.
+	Synced(objs []interface{})
+}
+
+func watch(g *workgroup.Group, c cache.Getter, log logrus.FieldLogger, resource string, objType runtime.Object, rs ...cache.ResourceEventHandler) cache.SharedIndexInformer {
+	var lw cache.ListerWatcher = cache.NewListWatchFromClient(c, resource, v1.NamespaceAll, fields.Everything())
+	var observers []ConnectionObserver
+	for _, r := range rs {
+		if o, ok := r.(ConnectionObserver); ok {
+			observers = append(observers, o)
+		}
+	}
+	if len(observers) > 0 {
+		lw = observe(lw, observers...)
+	}
+	sw := cache.NewSharedIndexInformer(lw, objType, time.Duration(0), cache.Indexers{}) // resync timer disabled
 	for _, r := range rs {
 		sw.AddEventHandler(r)
 	}
+	var syncers []SyncObserver
+	for _, r := range rs {
+		if o, ok := r.(SyncObserver); ok {
+			syncers = append(syncers, o)
+		}
+	}
 	g.Add(func(stop <-chan struct{}) error {
 		log := log.WithField("resource", resource)
 		log.Println("started")
 		defer log.Println("stopped")
+		if len(syncers) > 0 {
+			go func() {
+				if !cache.WaitForCacheSync(stop, sw.HasSynced) {
+					return
+				}
+				objs := sw.GetStore().List()
+				for _, o := range syncers {
+					o.Synced(objs)
+				}
+			}()
+		}
 		sw.Run(stop)
 		return nil
 	})
+	return sw
+}
+
+// observe wraps lw, notifying observers when lw transitions between
+// failing and succeeding.
+func observe(lw cache.ListerWatcher, observers ...ConnectionObserver) cache.ListerWatcher {
+	var disconnected int32
+	disconnect := func(err error) {
+		if atomic.CompareAndSwapInt32(&disconnected, 0, 1) {
+			for _, o := range observers {
+				o.Disconnected(err)
+			}
+		}
+	}
+	reconnect := func(objs []interface{}) {
+		if atomic.CompareAndSwapInt32(&disconnected, 1, 0) {
+			for _, o := range observers {
+				o.Reconnected(objs)
+			}
+		}
+	}
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			obj, err := lw.List(options)
+			if err != nil {
+				disconnect(err)
+				return obj, err
+			}
+			if atomic.LoadInt32(&disconnected) == 1 {
+				items, err := meta.ExtractList(obj)
+				if err != nil {
+					return nil, err
+				}
+				objs := make([]interface{}, len(items))
+				for i := range items {
+					objs[i] = items[i]
+				}
+				reconnect(objs)
+			}
+			return obj, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (k8swatch.Interface, error) {
+			w, err := lw.Watch(options)
+			if err != nil {
+				disconnect(err)
+				return w, err
+			}
+			reconnect(nil)
+			return w, nil
+		},
+	}
 }
@@ -0,0 +1,98 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8swatch "k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// connectionEvents records the calls made to a ConnectionObserver.
+type connectionEvents struct {
+	events []string
+	objs   []interface{}
+}
+
+func (c *connectionEvents) Disconnected(err error) {
+	c.events = append(c.events, "disconnected")
+}
+
+func (c *connectionEvents) Reconnected(objs []interface{}) {
+	if objs == nil {
+		c.events = append(c.events, "resumed")
+		return
+	}
+	c.events = append(c.events, "relisted")
+	c.objs = objs
+}
+
+func TestObserve(t *testing.T) {
+	simple := v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "simple",
+			Namespace: "default",
+		},
+	}
+	var err error
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			if err != nil {
+				return nil, err
+			}
+			return &v1.EndpointsList{Items: []v1.Endpoints{simple}}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (k8swatch.Interface, error) {
+			if err != nil {
+				return nil, err
+			}
+			return k8swatch.NewFake(), nil
+		},
+	}
+	var c connectionEvents
+	olw := observe(lw, &c)
+
+	// the first list is not a reconnection.
+	olw.List(metav1.ListOptions{})
+	olw.Watch(metav1.ListOptions{})
+
+	// the watch fails, and the relist fails until the API server recovers.
+	err = errors.New("connection refused")
+	olw.Watch(metav1.ListOptions{})
+	olw.List(metav1.ListOptions{})
+	olw.List(metav1.ListOptions{})
+	err = nil
+	olw.List(metav1.ListOptions{})
+	olw.Watch(metav1.ListOptions{})
+
+	// the watch fails, and is resumed without a relist.
+	err = errors.New("connection refused")
+	olw.Watch(metav1.ListOptions{})
+	err = nil
+	olw.Watch(metav1.ListOptions{})
+
+	want := []string{"disconnected", "relisted", "disconnected", "resumed"}
+	if !reflect.DeepEqual(want, c.events) {
+		t.Fatalf("expected: %v, got: %v", want, c.events)
+	}
+	if len(c.objs) != 1 || c.objs[0].(*v1.Endpoints).Name != "simple" {
+		t.Fatalf("expected the relisted endpoints, got %v", c.objs)
+	}
+}
@@ -16,6 +16,7 @@ package metrics
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/heptio/contour/internal/httpsvc"
 	"github.com/prometheus/client_golang/prometheus"
@@ -31,6 +32,17 @@ type Metrics struct {
 	ingressRouteOrphanedGauge   *prometheus.GaugeVec
 	ingressRouteDAGRebuildGauge *prometheus.GaugeVec
 
+	endpointsInformerDisconnectsCounter  prometheus.Counter
+	clusterNameCollisionsCounter         prometheus.Counter
+	endpointsClusterNameConflictsCounter prometheus.Counter
+	edsClusterMismatchGauge              *prometheus.GaugeVec
+	edsClusterEvictionsCounter           prometheus.Counter
+	malformedEndpointsCounter            prometheus.Counter
+	clusterEndpointsHistogram            *clusterEndpoints
+	scaleToZeroCounter                   prometheus.Counter
+	edsClusterLoadAssignmentsGauge       prometheus.Gauge
+	edsEndpointsGauge                    *prometheus.GaugeVec
+
 	CacheHandlerOnUpdateSummary prometheus.Summary
 	ResourceEventHandlerSummary *prometheus.SummaryVec
 
@@ -60,6 +72,17 @@ const (
 	IngressRouteOrphanedGauge   = "contour_ingressroute_orphaned_total"
 	IngressRouteDAGRebuildGauge = "contour_ingressroute_dagrebuild_timestamp"
 
+	EndpointsInformerDisconnectsCounter  = "contour_endpoints_informer_disconnects_total"
+	ClusterNameCollisionsCounter         = "contour_cluster_name_collisions_total"
+	EndpointsClusterNameConflictsCounter = "contour_endpoints_cluster_name_conflicts_total"
+	EDSClusterMismatchGauge              = "contour_eds_cluster_mismatch_total"
+	EDSClusterEvictionsCounter           = "contour_eds_cluster_evictions_total"
+	MalformedEndpointsCounter            = "contour_malformed_endpoints_total"
+	ClusterEndpointsHistogram            = "contour_eds_cluster_endpoints"
+	ScaleToZeroCounter                   = "contour_eds_scale_to_zero_total"
+	EDSClusterLoadAssignmentsGauge       = "contour_eds_cluster_load_assignments"
+	EDSEndpointsGauge                    = "contour_eds_endpoints"
+
 	cacheHandlerOnUpdateSummary = "contour_cachehandler_onupdate_duration_seconds"
 	resourceEventHandlerSummary = "contour_resourceeventhandler_duration_seconds"
 )
@@ -111,6 +134,71 @@ func NewMetrics(registry *prometheus.Registry) *Metrics {
 			},
 			[]string{},
 		),
+		endpointsInformerDisconnectsCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: EndpointsInformerDisconnectsCounter,
+				Help: "Total number of times the Endpoints informer lost its connection to the API server",
+			},
+		),
+		clusterNameCollisionsCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: ClusterNameCollisionsCounter,
+				Help: "Total number of services whose shortened cluster name collided with another service",
+			},
+		),
+		endpointsClusterNameConflictsCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: EndpointsClusterNameConflictsCounter,
+				Help: "Total number of Endpoints objects which published the same EDS cluster name as another Endpoints object",
+			},
+		),
+		edsClusterMismatchGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: EDSClusterMismatchGauge,
+				Help: "Number of clusters published by EDS but unknown to CDS (unknown), or known to CDS but not published by EDS (missing)",
+			},
+			[]string{"kind"},
+		),
+		edsClusterEvictionsCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: EDSClusterEvictionsCounter,
+				Help: "Total number of clusters evicted from EDS because the cluster limit was exceeded",
+			},
+		),
+		malformedEndpointsCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: MalformedEndpointsCounter,
+				Help: "Total number of malformed endpoint addresses skipped by EDS",
+			},
+		),
+		clusterEndpointsHistogram: &clusterEndpoints{
+			desc: prometheus.NewDesc(
+				ClusterEndpointsHistogram,
+				"Number of endpoints in each published ClusterLoadAssignment",
+				nil, nil,
+			),
+			buckets: prometheus.ExponentialBuckets(1, 2, 12),
+			counts:  make(map[string]int),
+		},
+		scaleToZeroCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: ScaleToZeroCounter,
+				Help: "Total number of Endpoints updates which left a service with no endpoints",
+			},
+		),
+		edsClusterLoadAssignmentsGauge: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: EDSClusterLoadAssignmentsGauge,
+				Help: "Number of ClusterLoadAssignments published by EDS",
+			},
+		),
+		edsEndpointsGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: EDSEndpointsGauge,
+				Help: "Number of endpoints in each ClusterLoadAssignment published by EDS",
+			},
+			[]string{"cluster"},
+		),
 		CacheHandlerOnUpdateSummary: prometheus.NewSummary(prometheus.SummaryOpts{
 			Name:       cacheHandlerOnUpdateSummary,
 			Help:       "Histogram for the runtime of xDS cache regeneration",
@@ -137,6 +225,16 @@ func (m *Metrics) register(registry *prometheus.Registry) {
 		m.ingressRouteValidGauge,
 		m.ingressRouteOrphanedGauge,
 		m.ingressRouteDAGRebuildGauge,
+		m.endpointsInformerDisconnectsCounter,
+		m.clusterNameCollisionsCounter,
+		m.endpointsClusterNameConflictsCounter,
+		m.edsClusterMismatchGauge,
+		m.edsClusterEvictionsCounter,
+		m.malformedEndpointsCounter,
+		m.clusterEndpointsHistogram,
+		m.scaleToZeroCounter,
+		m.edsClusterLoadAssignmentsGauge,
+		m.edsEndpointsGauge,
 		m.CacheHandlerOnUpdateSummary,
 		m.ResourceEventHandlerSummary,
 	)
@@ -147,6 +245,68 @@ func (m *Metrics) SetDAGRebuiltMetric(timestamp int64) {
 	m.ingressRouteDAGRebuildGauge.WithLabelValues().Set(float64(timestamp))
 }
 
+// IncEndpointsInformerDisconnects records that the Endpoints informer
+// lost its connection to the API server.
+func (m *Metrics) IncEndpointsInformerDisconnects() {
+	m.endpointsInformerDisconnectsCounter.Inc()
+}
+
+// IncClusterNameCollisions records that two services were given the
+// same shortened cluster name.
+func (m *Metrics) IncClusterNameCollisions() {
+	m.clusterNameCollisionsCounter.Inc()
+}
+
+// IncEndpointsClusterNameConflicts records that two Endpoints objects
+// published the same EDS cluster name.
+func (m *Metrics) IncEndpointsClusterNameConflicts() {
+	m.endpointsClusterNameConflictsCounter.Inc()
+}
+
+// IncEDSClusterEvictions records that a cluster was evicted from EDS
+// to stay within the cluster limit.
+func (m *Metrics) IncEDSClusterEvictions() {
+	m.edsClusterEvictionsCounter.Inc()
+}
+
+// IncMalformedEndpoints records that a malformed endpoint address
+// was skipped.
+func (m *Metrics) IncMalformedEndpoints() {
+	m.malformedEndpointsCounter.Inc()
+}
+
+// IncScaleToZero records that a service's endpoints went from some
+// to none.
+func (m *Metrics) IncScaleToZero() {
+	m.scaleToZeroCounter.Inc()
+}
+
+// SetEDSClusterLoadAssignments records the number of
+// ClusterLoadAssignments published by EDS.
+func (m *Metrics) SetEDSClusterLoadAssignments(n int) {
+	m.edsClusterLoadAssignmentsGauge.Set(float64(n))
+}
+
+// SetEDSEndpoints records the number of endpoints published for cluster.
+func (m *Metrics) SetEDSEndpoints(cluster string, n int) {
+	m.edsEndpointsGauge.WithLabelValues(cluster).Set(float64(n))
+	m.clusterEndpointsHistogram.set(cluster, n)
+}
+
+// DeleteEDSEndpoints removes the endpoint count of a cluster which
+// is no longer published.
+func (m *Metrics) DeleteEDSEndpoints(cluster string) {
+	m.edsEndpointsGauge.DeleteLabelValues(cluster)
+	m.clusterEndpointsHistogram.delete(cluster)
+}
+
+// SetEDSClusterMismatches records the number of clusters published by
+// EDS but unknown to CDS, and known to CDS but not published by EDS.
+func (m *Metrics) SetEDSClusterMismatches(unknown, missing int) {
+	m.edsClusterMismatchGauge.WithLabelValues("unknown").Set(float64(unknown))
+	m.edsClusterMismatchGauge.WithLabelValues("missing").Set(float64(missing))
+}
+
 // SetIngressRouteMetric sets metric values for a set of IngressRoutes
 func (m *Metrics) SetIngressRouteMetric(metrics IngressRouteMetric) {
 	// Process metrics
@@ -233,3 +393,50 @@ func registerHealthCheck(mux *http.ServeMux) {
 func registerMetrics(mux *http.ServeMux, registry *prometheus.Registry) {
 	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 }
+
+// clusterEndpoints is a prometheus.Collector which reports the number
+// of endpoints in each currently published ClusterLoadAssignment as a
+// histogram. The histogram is built from the current counts at scrape
+// time so a cluster which is republished is only counted once.
+type clusterEndpoints struct {
+	desc    *prometheus.Desc
+	buckets []float64
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *clusterEndpoints) set(cluster string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[cluster] = n
+}
+
+func (c *clusterEndpoints) delete(cluster string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.counts, cluster)
+}
+
+// Describe implements prometheus.Collector.
+func (c *clusterEndpoints) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *clusterEndpoints) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	buckets := make(map[float64]uint64, len(c.buckets))
+	var sum float64
+	for _, n := range c.counts {
+		sum += float64(n)
+		for _, b := range c.buckets {
+			if float64(n) <= b {
+				buckets[b]++
+			}
+		}
+	}
+	count := uint64(len(c.counts))
+	c.mu.Unlock()
+	ch <- prometheus.MustNewConstHistogram(c.desc, count, sum, buckets)
+}